@@ -0,0 +1,162 @@
+package lumberjack
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// backupBase returns the name that the backups of the named log file are
+// derived from, which is in the archive directory if there is one.  Without one,
+// partitioned backups of patterned log files go under the pattern's root.
+func (l *loggerOption) backupBase(name string) string {
+	switch {
+	case l.archiveDir != "":
+		return filepath.Join(l.archiveDir, filepath.Base(name))
+	case l.partitioned() && l.pattern != nil:
+		return filepath.Join(l.pattern.root(), filepath.Base(name))
+	}
+	return name
+}
+
+// partitioned reports whether backups are filed into subdirectories by their
+// rotation time.  Numbered backups are renamed in place, so they never are.
+func (l *loggerOption) partitioned() bool {
+	return l.partition != "" && !l.numbered
+}
+
+// partitionBase returns the name that a backup of the named log file rotated
+// at t is derived from, which is in the partition for t if backups are
+// partitioned.
+func (l *loggerOption) partitionBase(name string, t time.Time) string {
+	base := l.backupBase(name)
+	if !l.partitioned() {
+		return base
+	}
+	dir, file := filepath.Split(base)
+	return filepath.Join(dir, t.Format(l.partition), file)
+}
+
+// archivedFiles returns the files that may be backups derived from base, by
+// directory.  These are the files in the directory of base and, if backups are
+// partitioned, in the directories under it that are named like a partition,
+// so that the files of anything else kept there are left alone.
+func (l *loggerOption) archivedFiles(base string) (map[string][]os.FileInfo, error) {
+	root := filepath.Dir(base)
+	if !l.partitioned() {
+		files, err := ioutil.ReadDir(root)
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]os.FileInfo{root: files}, nil
+	}
+
+	dirs, err := walkDirs(root, strings.Count(l.partition, "/")+1)
+	for dir := range dirs {
+		if dir != root && !l.isPartition(root, dir) {
+			delete(dirs, dir)
+		}
+	}
+	return dirs, err
+}
+
+// isPartition reports whether dir, under root, is named like a partition.
+func (l *loggerOption) isPartition(root, dir string) bool {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return false
+	}
+	_, err = time.Parse(l.partition, filepath.ToSlash(rel))
+	return err == nil
+}
+
+// backupsAmong returns the backups derived from base among the files in dirs.
+func (l *loggerOption) backupsAmong(base string, dirs map[string][]os.FileInfo) []logInfo {
+	logFiles := []logInfo{}
+	for dir, files := range dirs {
+		logFiles = append(logFiles, l.backupsOf(filepath.Join(dir, filepath.Base(base)), files)...)
+	}
+	return logFiles
+}
+
+// walkDirs returns the files in root and every directory under it, by
+// directory, going no more than depth directories down unless depth is
+// negative.
+func walkDirs(root string, depth int) (map[string][]os.FileInfo, error) {
+	dirs := make(map[string][]os.FileInfo)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// skip what we can't read rather than giving up on the rest.
+			return nil
+		}
+		if info.IsDir() && depth >= 0 && path != root {
+			rel, _ := filepath.Rel(root, path)
+			if strings.Count(filepath.ToSlash(rel), "/") >= depth {
+				return filepath.SkipDir
+			}
+		}
+		if !info.IsDir() {
+			dir := filepath.Dir(path)
+			dirs[dir] = append(dirs[dir], info)
+		}
+		return nil
+	})
+	return dirs, err
+}
+
+// moveFile renames src to dst.  If they are on different devices, which rename
+// can't handle, it copies src to dst and removes src instead.
+func moveFile(src, dst string) error {
+	err := rename(src, dst)
+	if le, ok := err.(*os.LinkError); !ok || le.Err != syscall.EXDEV {
+		return err
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		os.Remove(dst) // nolint
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile copies src to dst with the same mode and owner, and syncs it to
+// disk.
+func copyFile(src, dst string) error {
+	f, err := os.Open(src) // nolint
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	defer f.Close() // nolint
+
+	info, err := Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat log file: %v", err)
+	}
+
+	// this is a no-op anywhere but linux
+	if err := chown(dst, info); err != nil {
+		return fmt.Errorf("failed to chown archived log file: %v", err)
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode()) // nolint
+	if err != nil {
+		return fmt.Errorf("failed to open archived log file: %v", err)
+	}
+	defer out.Close() // nolint
+
+	if _, err := io.Copy(out, f); err != nil {
+		return fmt.Errorf("failed to copy log file: %v", err)
+	}
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("failed to sync archived log file: %v", err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,251 @@
+package lumberjack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveDir(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestArchiveDir", t)
+	defer os.RemoveAll(dir) // nolint
+
+	archive := filepath.Join(dir, "archive")
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithArchiveDir(archive),
+		WithMaxBytes(10),
+		WithMaxBackups(1),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+
+	newFakeTime()
+	b2 := []byte("foooooo!")
+	_, err = l.Write(b2)
+	require.NoError(t, err)
+
+	existsWithContent(filename, b2, t)
+	existsWithContent(backupFile(archive), b, t)
+	fileCount(dir, 2, t)
+
+	newFakeTime()
+	b3 := []byte("baaaaar!")
+	_, err = l.Write(b3)
+	require.NoError(t, err)
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+
+	// the oldest backup in the archive directory was removed.
+	existsWithContent(filename, b3, t)
+	existsWithContent(backupFile(archive), b2, t)
+	fileCount(archive, 1, t)
+}
+
+func TestArchiveDirNumbered(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestArchiveDirNumbered", t)
+	defer os.RemoveAll(dir) // nolint
+
+	archive := filepath.Join(dir, "archive")
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithArchiveDir(archive),
+		WithMaxBytes(10),
+		WithNumberedBackups(),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+	b2 := []byte("foooooo!")
+	_, err = l.Write(b2)
+	require.NoError(t, err)
+	b3 := []byte("baaaaar!")
+	_, err = l.Write(b3)
+	require.NoError(t, err)
+
+	archived := filepath.Join(archive, filepath.Base(filename))
+	existsWithContent(filename, b3, t)
+	existsWithContent(archived+".1", b2, t)
+	existsWithContent(archived+".2", b, t)
+}
+
+func TestArchiveDirCrossDevice(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestArchiveDirCrossDevice", t)
+	defer os.RemoveAll(dir) // nolint
+
+	// pretend the archive directory is on another device.
+	rename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+	defer func() { rename = os.Rename }()
+
+	archive := filepath.Join(dir, "archive")
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithArchiveDir(archive),
+		WithMaxBytes(10),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+
+	newFakeTime()
+	b2 := []byte("foooooo!")
+	_, err = l.Write(b2)
+	require.NoError(t, err)
+
+	existsWithContent(filename, b2, t)
+	existsWithContent(backupFile(archive), b, t)
+	fileCount(dir, 2, t)
+}
+
+func TestArchivePartitions(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestArchivePartitions", t)
+	defer os.RemoveAll(dir) // nolint
+
+	archive := filepath.Join(dir, "archive")
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithArchiveDir(archive),
+		WithArchivePartitions("2006/01/02"),
+		WithMaxBytes(10),
+		WithMaxBackups(1),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	partition := func() string {
+		return filepath.Join(archive, fakeTime().UTC().Format("2006/01/02"))
+	}
+
+	b := []byte("boo!")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+
+	newFakeTime()
+	first := partition()
+	b2 := []byte("foooooo!")
+	_, err = l.Write(b2)
+	require.NoError(t, err)
+	existsWithContent(backupFile(first), b, t)
+
+	newFakeTime()
+	second := partition()
+	b3 := []byte("baaaaar!")
+	_, err = l.Write(b3)
+	require.NoError(t, err)
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+
+	// the oldest backup was removed along with its empty partition.
+	existsWithContent(filename, b3, t)
+	existsWithContent(backupFile(second), b2, t)
+	notExist(first, t)
+	exists(archive, t)
+}
+
+func TestArchivePartitionsBesideLogFile(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestArchivePartitionsBesideLogFile", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithArchivePartitions("2006-01"),
+		WithMaxBytes(10),
+		WithCompress(),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+
+	newFakeTime()
+	b2 := []byte("foooooo!")
+	_, err = l.Write(b2)
+	require.NoError(t, err)
+
+	// we need to wait a little bit since the files get compressed on a
+	// different goroutine.
+	<-time.After(300 * time.Millisecond)
+
+	partition := filepath.Join(dir, fakeTime().UTC().Format("2006-01"))
+	notExist(backupFile(partition), t)
+	exists(backupFile(partition)+compressSuffix, t)
+	existsWithContent(filename, b2, t)
+}
+
+func TestArchivePartitionsLeaveOtherDirs(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestArchivePartitionsLeaveOtherDirs", t)
+	defer os.RemoveAll(dir) // nolint
+
+	// another application's backup, with the same name, in a directory that
+	// isn't a partition.
+	other := filepath.Join(dir, "otherapp")
+	err := os.Mkdir(other, 0700)
+	require.NoError(t, err)
+	otherBackup := backupFile(other)
+	data := []byte("data")
+	err = ioutil.WriteFile(otherBackup, data, 0600)
+	require.NoError(t, err)
+
+	newFakeTime()
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithArchivePartitions("2006-01"),
+		WithMaxBytes(10),
+		WithMaxBackups(1),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+
+	newFakeTime()
+	b2 := []byte("foooooo!")
+	_, err = l.Write(b2)
+	require.NoError(t, err)
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+
+	partition := filepath.Join(dir, fakeTime().UTC().Format("2006-01"))
+	existsWithContent(backupFile(partition), b, t)
+	existsWithContent(otherBackup, data, t)
+}
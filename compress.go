@@ -0,0 +1,254 @@
+package lumberjack
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// Compressor compresses backups.  Backups compressed by a logger's own
+// Compressor or any registered one are recognized by their suffix, so that
+// they are cleaned up along with the others.  The suffix must start with a dot.
+type Compressor interface {
+	// Suffix is appended to the name of a backup when it is compressed,
+	// such as ".gz".
+	Suffix() string
+
+	// NewWriter returns a writer that compresses what is written to it into
+	// w.  Closing it must flush everything to w, but not close w.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+
+	// NewReader returns a reader that decompresses what is read from r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]Compressor{
+		compressSuffix: Gzip(gzip.DefaultCompression),
+		zlibSuffix:     Zlib(zlib.DefaultCompression),
+		flateSuffix:    Flate(flate.DefaultCompression),
+	}
+)
+
+const (
+	zlibSuffix  = ".zlib"
+	flateSuffix = ".deflate"
+)
+
+// RegisterCompressor registers c, so that backups with its suffix are
+// recognized as compressed by every logger.  A logger recognizes the backups
+// of its own compressor, passed to WithCompressor, without registering it,
+// but backups left over from another compressor are only recognized if it is
+// registered.  A later registration for the same suffix replaces an earlier
+// one.
+func RegisterCompressor(c Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[c.Suffix()] = c
+}
+
+// validSuffix reports whether suffix can tell compressed backups apart from
+// the others, and from those being compressed.
+func validSuffix(suffix string) bool {
+	return strings.HasPrefix(suffix, ".") && len(suffix) > 1 && suffix != compressTmpSuffix
+}
+
+// compressedSuffixes returns the suffixes of the registered compressors and of
+// the logger's own compressor.
+func (l *loggerOption) compressedSuffixes() []string {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+
+	suffixes := make([]string, 0, len(compressors)+1)
+	for s := range compressors {
+		suffixes = append(suffixes, s)
+	}
+	if l.compressor != nil {
+		suffixes = append(suffixes, l.compressor.Suffix())
+	}
+	return suffixes
+}
+
+// compressedSuffix returns the longest suffix of a compressor recognized by
+// the logger that name ends with, or "" if it doesn't end with any.
+func (l *loggerOption) compressedSuffix(name string) string {
+	suffix := ""
+	for _, s := range l.compressedSuffixes() {
+		if len(s) > len(suffix) && strings.HasSuffix(name, s) {
+			suffix = s
+		}
+	}
+	return suffix
+}
+
+// trimCompressed returns name without the suffix of a compressor recognized by
+// the logger.
+func (l *loggerOption) trimCompressed(name string) string {
+	return name[:len(name)-len(l.compressedSuffix(name))]
+}
+
+// interruptedName returns the name of the compressed file that the named file
+// was being written as, and whether it is one that is being written.
+func (l *loggerOption) interruptedName(name string) (string, bool) {
+	compressed := strings.TrimSuffix(name, compressTmpSuffix)
+	if compressed == name || !l.isCompressed(compressed) {
+		return name, false
+	}
+	return compressed, true
+}
+
+// isCompressed reports whether name ends with the suffix of a compressor
+// recognized by the logger.
+func (l *loggerOption) isCompressed(name string) bool {
+	return l.compressedSuffix(name) != ""
+}
+
+// compressedExists reports whether a compressed copy of the named file exists,
+// with the suffix of any compressor recognized by the logger.
+func (l *loggerOption) compressedExists(name string) bool {
+	for _, suffix := range l.compressedSuffixes() {
+		if fileExists(name + suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// backupTaken reports whether a backup exists at the given name, compressed
+// or not.
+func (l *loggerOption) backupTaken(name string) bool {
+	return fileExists(name) || l.compressedExists(name)
+}
+
+// compressAll compresses files with the compressor, using up to
+// compressWorkers goroutines, and waits for them all to finish.  It returns the
+// first error encountered, if any.
+func (l *loggerOption) compressAll(files []plannedFile) error {
+	workers := l.compressWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(files) {
+		workers = len(files)
+	}
+
+	jobs := make(chan string)
+	errs := make(chan error, len(files))
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fn := range jobs {
+				errs <- l.compressLogFile(fn)
+			}
+		}()
+	}
+	for _, f := range files {
+		jobs <- f.path()
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+
+	var err error
+	for errCompress := range errs {
+		if err == nil && errCompress != nil {
+			err = errCompress
+		}
+	}
+	return err
+}
+
+// withLevel returns the built-in compressor c, or gzip if c is nil, set to
+// compress at level.  The level of other compressors is up to them.
+func withLevel(c Compressor, level int) (Compressor, error) {
+	switch c.(type) {
+	case nil, gzipCompressor:
+		c = Gzip(level)
+	case zlibCompressor:
+		c = Zlib(level)
+	case flateCompressor:
+		c = Flate(level)
+	default:
+		return nil, fmt.Errorf("compression level can't be set for the %q compressor", c.Suffix())
+	}
+
+	w, err := c.NewWriter(ioutil.Discard)
+	if err != nil {
+		return nil, fmt.Errorf("invalid compression level %d: %v", level, err)
+	}
+	return c, w.Close()
+}
+
+// Gzip returns a Compressor that writes gzip files with the ".gz" suffix, at
+// a level from compress/gzip such as gzip.BestSpeed.
+func Gzip(level int) Compressor {
+	return gzipCompressor{level: level}
+}
+
+type gzipCompressor struct {
+	level int
+}
+
+func (c gzipCompressor) Suffix() string {
+	return compressSuffix
+}
+
+func (c gzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, c.level)
+}
+
+func (c gzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// Zlib returns a Compressor that writes zlib streams with the ".zlib" suffix,
+// at a level from compress/zlib such as zlib.BestSpeed.
+func Zlib(level int) Compressor {
+	return zlibCompressor{level: level}
+}
+
+type zlibCompressor struct {
+	level int
+}
+
+func (c zlibCompressor) Suffix() string {
+	return zlibSuffix
+}
+
+func (c zlibCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zlib.NewWriterLevel(w, c.level)
+}
+
+func (c zlibCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(r)
+}
+
+// Flate returns a Compressor that writes raw deflate streams with the
+// ".deflate" suffix, at a level from compress/flate such as flate.BestSpeed.
+func Flate(level int) Compressor {
+	return flateCompressor{level: level}
+}
+
+type flateCompressor struct {
+	level int
+}
+
+func (c flateCompressor) Suffix() string {
+	return flateSuffix
+}
+
+func (c flateCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, c.level)
+}
+
+func (c flateCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
@@ -0,0 +1,417 @@
+package lumberjack
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// nopCompressor "compresses" by copying, with its own suffix.
+type nopCompressor struct{}
+
+func (nopCompressor) Suffix() string {
+	return ".nop"
+}
+
+func (nopCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (nopCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(r), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestCompressors(t *testing.T) {
+	tests := []struct {
+		c      Compressor
+		suffix string
+	}{
+		{Gzip(gzip.BestSpeed), ".gz"},
+		{Zlib(zlib.BestCompression), ".zlib"},
+		{Flate(flate.DefaultCompression), ".deflate"},
+	}
+
+	content := bytes.Repeat([]byte("compress me\n"), 100)
+	for _, test := range tests {
+		require.Equal(t, test.suffix, test.c.Suffix())
+
+		var buf bytes.Buffer
+		w, err := test.c.NewWriter(&buf)
+		require.NoError(t, err, test.suffix)
+		_, err = w.Write(content)
+		require.NoError(t, err, test.suffix)
+		require.NoError(t, w.Close(), test.suffix)
+		require.True(t, buf.Len() < len(content), test.suffix)
+
+		r, err := test.c.NewReader(&buf)
+		require.NoError(t, err, test.suffix)
+		got, err := ioutil.ReadAll(r)
+		require.NoError(t, err, test.suffix)
+		require.NoError(t, r.Close(), test.suffix)
+		require.Equal(t, content, got, test.suffix)
+	}
+
+	_, err := Gzip(42).NewWriter(ioutil.Discard)
+	require.Error(t, err)
+}
+
+func TestCompressedSuffix(t *testing.T) {
+	RegisterCompressor(nopCompressor{})
+
+	tests := []struct {
+		name, suffix string
+	}{
+		{"foo.log.gz", ".gz"},
+		{"foo.log.zlib", ".zlib"},
+		{"foo.log.deflate", ".deflate"},
+		{"foo.log.nop", ".nop"},
+		{"foo.log", ""},
+		{"foo.gz.log", ""},
+	}
+
+	l := &loggerOption{}
+	for _, test := range tests {
+		require.Equal(t, test.suffix, l.compressedSuffix(test.name), test.name)
+		require.Equal(t, test.suffix != "", l.isCompressed(test.name), test.name)
+	}
+	require.Equal(t, "foo.log", l.trimCompressed("foo.log.zlib"))
+
+	// a logger's own compressor is recognized by it alone.
+	own := &loggerOption{compressor: suffixCompressor{suffix: ".own"}}
+	require.True(t, own.isCompressed("foo.log.own"))
+	require.False(t, l.isCompressed("foo.log.own"))
+}
+
+// suffixCompressor "compresses" by copying, with any suffix.
+type suffixCompressor struct {
+	nopCompressor
+	suffix string
+}
+
+func (c suffixCompressor) Suffix() string {
+	return c.suffix
+}
+
+func TestCompressorSuffix(t *testing.T) {
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestCompressorSuffix", t)
+	defer os.RemoveAll(dir) // nolint
+
+	// compressing to any of these would overwrite or hide the backup.
+	for _, suffix := range []string{"", ".", "gz", compressTmpSuffix} {
+		_, err := New(
+			WithFileName(logFile(dir)),
+			WithCompressor(suffixCompressor{suffix: suffix}),
+		)
+		require.Error(t, err, suffix)
+	}
+	fileCount(dir, 0, t)
+}
+
+func TestWithCompressor(t *testing.T) {
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestWithCompressor", t)
+	defer os.RemoveAll(dir) // nolint
+
+	// a backup compressed with gzip before switching to zlib still counts.
+	older := backupFile(dir) + compressSuffix
+	require.NoError(t, ioutil.WriteFile(older, []byte("older"), 0600))
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBytes(10),
+		WithMaxBackups(1),
+		WithCompressor(Zlib(zlib.BestSpeed)),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+
+	newFakeTime()
+	require.NoError(t, l.Rotate())
+
+	// we need to wait a little bit since the files get compressed on a different
+	// goroutine.
+	<-time.After(300 * time.Millisecond)
+
+	notExist(older, t)
+	notExist(backupFile(dir), t)
+
+	f, err := os.Open(backupFile(dir) + ".zlib")
+	require.NoError(t, err)
+	defer f.Close() // nolint
+	r, err := Zlib(zlib.BestSpeed).NewReader(f)
+	require.NoError(t, err)
+	got, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, b, got)
+
+	fileCount(dir, 2, t)
+}
+
+// slowCompressor copies slowly, keeping track of how many copies are running
+// at once.
+type slowCompressor struct {
+	nopCompressor
+	mu           *sync.Mutex
+	active, peak *int
+}
+
+func (c slowCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.active++
+	if *c.active > *c.peak {
+		*c.peak = *c.active
+	}
+	return slowWriteCloser{w, c}, nil
+}
+
+type slowWriteCloser struct {
+	io.Writer
+	c slowCompressor
+}
+
+func (w slowWriteCloser) Close() error {
+	<-time.After(20 * time.Millisecond)
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+	*w.c.active--
+	return nil
+}
+
+func TestCompressWorkers(t *testing.T) {
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestCompressWorkers", t)
+	defer os.RemoveAll(dir) // nolint
+
+	var backups []string
+	for i := 0; i < 6; i++ {
+		backups = append(backups, backupFile(dir))
+		require.NoError(t, ioutil.WriteFile(backupFile(dir), []byte("backup"), 0600))
+		newFakeTime()
+	}
+
+	var active, peak int
+	c := slowCompressor{mu: &sync.Mutex{}, active: &active, peak: &peak}
+	l, err := New(
+		WithFileName(logFile(dir)),
+		WithCompressor(c),
+		WithCompressWorkers(3),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	// we need to wait a little bit since the files get compressed on a different
+	// goroutine.
+	<-time.After(300 * time.Millisecond)
+
+	for _, name := range backups {
+		notExist(name, t)
+		existsWithContent(name+".nop", []byte("backup"), t)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	require.Equal(t, 3, peak)
+	require.Equal(t, 0, active)
+}
+
+func TestCompressionLevel(t *testing.T) {
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestCompressionLevel", t)
+	defer os.RemoveAll(dir) // nolint
+
+	content := bytes.Repeat([]byte("compress me\n"), 100)
+	require.NoError(t, ioutil.WriteFile(backupFile(dir), content, 0600))
+
+	l, err := New(
+		WithFileName(logFile(dir)),
+		WithCompressionLevel(gzip.NoCompression),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	// we need to wait a little bit since the files get compressed on a different
+	// goroutine.
+	<-time.After(300 * time.Millisecond)
+
+	// without compression, the gzip file is larger than what it holds.
+	info, err := os.Stat(backupFile(dir) + compressSuffix)
+	require.NoError(t, err)
+	require.True(t, info.Size() > int64(len(content)))
+	notExist(backupFile(dir), t)
+}
+
+func TestCompressionLevelOptions(t *testing.T) {
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestCompressionLevelOptions", t)
+	defer os.RemoveAll(dir) // nolint
+
+	// the level applies to the chosen compressor, whichever comes first.
+	for _, opts := range [][]LoggerOption{
+		{WithCompressor(Zlib(zlib.DefaultCompression)), WithCompressionLevel(zlib.BestSpeed)},
+		{WithCompressionLevel(zlib.BestSpeed), WithCompressor(Zlib(zlib.DefaultCompression))},
+	} {
+		l, err := New(append(opts, WithFileName(logFile(dir)))...)
+		require.NoError(t, err)
+		require.Equal(t, Zlib(zlib.BestSpeed), l.(*loggerOption).compressor)
+		require.NoError(t, l.Close())
+	}
+
+	_, err := New(
+		WithFileName(logFile(dir)),
+		WithCompressionLevel(42),
+	)
+	require.Error(t, err)
+
+	_, err = New(
+		WithFileName(logFile(dir)),
+		WithCompressor(nopCompressor{}),
+		WithCompressionLevel(gzip.BestSpeed),
+	)
+	require.Error(t, err)
+}
+
+func TestDelayCompress(t *testing.T) {
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestDelayCompress", t)
+	defer os.RemoveAll(dir) // nolint
+
+	var backups []string
+	for i := 0; i < 3; i++ {
+		newFakeTime()
+		backups = append(backups, backupFile(dir))
+		require.NoError(t, ioutil.WriteFile(backupFile(dir), []byte("backup"), 0600))
+	}
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithCompress(),
+		WithDelayCompress(1),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	// we need to wait a little bit since the files get compressed on a different
+	// goroutine.
+	<-time.After(300 * time.Millisecond)
+
+	exists(backups[0]+compressSuffix, t)
+	exists(backups[1]+compressSuffix, t)
+	existsWithContent(backups[2], []byte("backup"), t)
+
+	// after another rotation, the previous backup is compressed in turn.
+	newFakeTime()
+	require.NoError(t, l.Rotate())
+	<-time.After(300 * time.Millisecond)
+
+	notExist(backups[2], t)
+	exists(backups[2]+compressSuffix, t)
+	existsWithContent(backupFile(dir), []byte{}, t)
+	fileCount(dir, 5, t)
+}
+
+// failingCompressor fails to start compressing.
+type failingCompressor struct {
+	nopCompressor
+}
+
+func (failingCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nil, errors.New("no compression today")
+}
+
+func TestCompressLogFileFailure(t *testing.T) {
+	dir := makeTempDir("TestCompressLogFileFailure", t)
+	defer os.RemoveAll(dir) // nolint
+
+	src := logFile(dir)
+	require.NoError(t, ioutil.WriteFile(src, []byte("boo!"), 0600))
+
+	l := &loggerOption{compressor: failingCompressor{}}
+	err := l.compressLogFile(src)
+	require.EqualError(t, err, "failed to compress log file: no compression today")
+
+	// nothing is left behind but the log file.
+	existsWithContent(src, []byte("boo!"), t)
+	fileCount(dir, 1, t)
+}
+
+func TestCompressInterrupted(t *testing.T) {
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestCompressInterrupted", t)
+	defer os.RemoveAll(dir) // nolint
+
+	// a crash cut the compression of the backup short.
+	backup := backupFile(dir)
+	require.NoError(t, ioutil.WriteFile(backup, []byte("backup"), 0600))
+	partial := backup + compressSuffix + compressTmpSuffix
+	require.NoError(t, ioutil.WriteFile(partial, []byte("partial"), 0600))
+
+	filename := logFile(dir)
+	plans := make(chan RetentionPlan, 1)
+	l, err := New(
+		WithFileName(filename),
+		WithCompress(),
+		WithDryRun(func(p RetentionPlan) { plans <- p }),
+	)
+	require.NoError(t, err)
+
+	select {
+	case p := <-plans:
+		require.Equal(t, RetentionPlan{
+			Compress: []RetentionAction{{Path: backup, Reason: ReasonCompress}},
+			Remove:   []RetentionAction{{Path: partial, Reason: ReasonInterrupted}},
+		}, p)
+	case <-time.After(time.Second):
+		t.Fatal("dry run didn't report a plan")
+	}
+	require.NoError(t, l.Close())
+
+	// on startup, the leftovers are removed and the backup compressed again.
+	l, err = New(
+		WithFileName(filename),
+		WithCompress(),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	// we need to wait a little bit since the files get compressed on a different
+	// goroutine.
+	<-time.After(300 * time.Millisecond)
+
+	notExist(partial, t)
+	notExist(backup, t)
+	gzipWithContent(backup+compressSuffix, []byte("backup"), t)
+	fileCount(dir, 2, t)
+}
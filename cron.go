@@ -0,0 +1,214 @@
+package lumberjack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a Schedule described by a cron expression.  Each field is a
+// bit set of the values at which it matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// domStar and dowStar record whether the day of month and day of week
+	// fields were unrestricted, which changes how they combine.
+	domStar, dowStar bool
+}
+
+// cronField describes the range and the names accepted by a cron field.
+type cronField struct {
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField = cronField{min: 0, max: 59}
+	hourField   = cronField{min: 0, max: 23}
+	domField    = cronField{min: 1, max: 31}
+	monthField  = cronField{min: 1, max: 12, names: []string{
+		"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec",
+	}}
+	// day of week accepts 7 as an alias for Sunday.
+	dowField = cronField{min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+	}}
+)
+
+// cronDescriptors are the shorthands accepted in place of the five fields.
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronYears bounds how far ahead Next looks for a matching time.
+const cronYears = 5
+
+// ParseCron parses a standard five field cron expression (minute, hour, day
+// of month, month and day of week) into a Schedule.  Fields accept numbers,
+// `*`, ranges, lists and steps, and month and day of week also accept three
+// letter English names.  For example `30 2 * * mon-fri` rotates at 02:30 on
+// weekdays.  The descriptors @yearly, @monthly, @weekly, @daily and @hourly
+// are accepted as well.
+func ParseCron(spec string) (Schedule, error) {
+	expr := strings.TrimSpace(spec)
+	if d, ok := cronDescriptors[strings.ToLower(expr)]; ok {
+		expr = d
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 { // nolint
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, has %d", spec, len(fields))
+	}
+
+	s := &cronSchedule{
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+	for i, f := range []struct {
+		bits  *uint64
+		field cronField
+	}{
+		{&s.minute, minuteField},
+		{&s.hour, hourField},
+		{&s.dom, domField},
+		{&s.month, monthField},
+		{&s.dow, dowField},
+	} {
+		bits, err := f.field.parse(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %v", spec, err)
+		}
+		*f.bits = bits
+	}
+
+	// fold Sunday as 7 into Sunday as 0.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	return s, nil
+}
+
+// parse returns the bit set of the values matched by a comma separated list of
+// cron items.
+func (c cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		b, err := c.parseItem(item)
+		if err != nil {
+			return 0, err
+		}
+		bits |= b
+	}
+	return bits, nil
+}
+
+// parseItem returns the bit set of the values matched by a single cron item,
+// which is `*`, a value or a range, optionally followed by `/step`.
+func (c cronField) parseItem(item string) (uint64, error) {
+	rng, step := item, 1
+	if i := strings.Index(item, "/"); i >= 0 {
+		var err error
+		rng = item[:i]
+		step, err = strconv.Atoi(item[i+1:])
+		if err != nil || step <= 0 {
+			return 0, fmt.Errorf("invalid step in %q", item)
+		}
+	}
+
+	var lo, hi int
+	switch {
+	case rng == "*":
+		lo, hi = c.min, c.max
+	case strings.Contains(rng, "-"):
+		i := strings.Index(rng, "-")
+		var err error
+		if lo, err = c.value(rng[:i]); err != nil {
+			return 0, err
+		}
+		if hi, err = c.value(rng[i+1:]); err != nil {
+			return 0, err
+		}
+	default:
+		var err error
+		if lo, err = c.value(rng); err != nil {
+			return 0, err
+		}
+		hi = lo
+		// a single value with a step runs to the end of the range.
+		if step > 1 {
+			hi = c.max
+		}
+	}
+	if lo > hi {
+		return 0, fmt.Errorf("invalid range %q", rng)
+	}
+
+	var bits uint64
+	for v := lo; v <= hi; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits, nil
+}
+
+// value parses a single number or name, checking it against the field's range.
+func (c cronField) value(s string) (int, error) {
+	for i, name := range c.names {
+		if name != "" && strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < c.min || v > c.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, c.min, c.max)
+	}
+	return v, nil
+}
+
+// Next implements Schedule.  It returns the zero time if the expression
+// doesn't match within the next few years, such as for the 30th of February.
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	limit := t.Year() + cronYears
+
+	for t.Year() <= limit {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			// step in absolute time so that daylight saving transitions
+			// can't send us back to an hour already checked.
+			t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the day of t matches the schedule.  As in cron,
+// if both the day of month and the day of week are restricted, matching either
+// is enough.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,84 @@
+package lumberjack
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{"30 2 * * 1-5", false},
+		{"*/15 * * * *", false},
+		{"0 0 1,15 jan-jun sun", false},
+		{"@daily", false},
+		{"30 2 * *", true},
+		{"60 * * * *", true},
+		{"* * * * mon-sun-tue", true},
+		{"5-3 * * * *", true},
+		{"*/0 * * * *", true},
+		{"@fortnightly", true},
+	}
+
+	for _, test := range tests {
+		_, err := ParseCron(test.spec)
+		require.Equal(t, test.wantErr, err != nil, test.spec)
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2020-10-09 was a Friday.
+	now := time.Date(2020, 10, 9, 14, 44, 33, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"30 2 * * mon-fri", time.Date(2020, 10, 12, 2, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, 10, 9, 14, 45, 0, 0, time.UTC)},
+		{"45 14 * * *", time.Date(2020, 10, 9, 14, 45, 0, 0, time.UTC)},
+		{"44 14 * * *", time.Date(2020, 10, 10, 14, 44, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2020, 10, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2020, 10, 11, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2020, 10, 9, 15, 0, 0, 0, time.UTC)},
+		{"0 0 30 feb *", time.Time{}},
+	}
+
+	for _, test := range tests {
+		s, err := ParseCron(test.spec)
+		require.NoError(t, err)
+		require.Equal(t, test.want, s.Next(now), test.spec)
+	}
+}
+
+func TestNextRotation(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestNextRotation", t)
+	defer os.RemoveAll(dir) // nolint
+
+	s, err := ParseCron("30 2 * * mon-fri")
+	require.NoError(t, err)
+
+	l, err := New(
+		WithFileName(logFile(dir)),
+		WithSchedule(s),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	require.Equal(t, s.Next(fakeTime().UTC()), l.(Scheduler).NextRotation())
+
+	l2, err := New(
+		WithFileName(logFile(dir)),
+	)
+	require.NoError(t, err)
+	defer l2.Close() // nolint
+
+	require.True(t, l2.(Scheduler).NextRotation().IsZero())
+}
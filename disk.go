@@ -0,0 +1,211 @@
+package lumberjack
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Degraded determines what happens to writes while the free space on the log
+// file's filesystem is below the critical watermark.
+type Degraded int
+
+const (
+	// DegradedDrop discards writes, reporting them as written.  This is the
+	// default.
+	DegradedDrop Degraded = iota
+	// DegradedSample writes only one in every sample-rate writes and discards
+	// the rest.
+	DegradedSample
+	// DegradedStderr writes to stderr instead of the log file.
+	DegradedStderr
+)
+
+// defaultSampleRate is how many writes DegradedSample keeps one of, unless
+// configured otherwise.
+const defaultSampleRate = 100
+
+// diskLevel is how close the log file's filesystem is to being full.
+type diskLevel int
+
+const (
+	diskOK diskLevel = iota
+	diskLow
+	diskCritical
+)
+
+var (
+	// freeSpace exists so it can be mocked out by tests.
+	freeSpace = diskFree
+
+	// deviceOf exists so it can be mocked out by tests.
+	deviceOf = diskDevice
+
+	// stderr exists so it can be mocked out by tests.
+	stderr io.Writer = os.Stderr
+
+	// diskCheckInterval is how often the free space is checked while writing.
+	diskCheckInterval = time.Second
+)
+
+// DiskSpaceError reports that the free space on the filesystem of the log file
+// fell below a watermark.
+type DiskSpaceError struct {
+	// Dir is the directory of the log file.
+	Dir string
+
+	// Free is the number of bytes available to the logger.
+	Free uint64
+
+	// Watermark is the watermark that Free fell below.
+	Watermark uint64
+
+	// Critical is true for the critical watermark, and false for the low one.
+	Critical bool
+}
+
+// Error implements error.
+func (e *DiskSpaceError) Error() string {
+	level := "low"
+	if e.Critical {
+		level = "critical"
+	}
+	return fmt.Sprintf(
+		"free space in %s is %d bytes, below the %s watermark of %d bytes",
+		e.Dir, e.Free, level, e.Watermark,
+	)
+}
+
+// checkDisk updates the disk level from the free space on the log file's
+// filesystem, at most once every diskCheckInterval.  Whenever the level falls
+// below a watermark, the condition is reported and the mill prunes backups
+// until there is enough space again.  If the free space can't be found out,
+// the level is left as it was.
+func (l *loggerOption) checkDisk() {
+	if l.lowWatermark == 0 && l.criticalWatermark == 0 {
+		return
+	}
+
+	now := currentTime()
+	if !l.diskChecked.IsZero() && now.Sub(l.diskChecked) < diskCheckInterval {
+		return
+	}
+	l.diskChecked = now
+
+	dir := l.dir()
+	free, err := freeSpace(dir)
+	if err != nil {
+		return
+	}
+
+	level, watermark := diskOK, uint64(0)
+	switch {
+	case free < l.criticalWatermark:
+		level, watermark = diskCritical, l.criticalWatermark
+	case free < l.lowWatermark:
+		level, watermark = diskLow, l.lowWatermark
+	}
+
+	if level != diskOK && level != l.diskLevel {
+		l.report(&DiskSpaceError{
+			Dir:       dir,
+			Free:      free,
+			Watermark: watermark,
+			Critical:  level == diskCritical,
+		})
+	}
+	l.diskLevel = level
+	if level != diskOK {
+		l.mill()
+	}
+}
+
+// writeDegraded handles a write while the disk level is critical, according
+// to the Degraded mode.
+func (l *loggerOption) writeDegraded(p []byte) (n int, err error) {
+	switch l.degraded {
+	case DegradedSample:
+		rate := l.sampleRate
+		if rate <= 0 {
+			rate = defaultSampleRate
+		}
+		l.sampled++
+		if (l.sampled-1)%rate == 0 {
+			return l.writeAll(p)
+		}
+		return len(p), nil
+	case DegradedStderr:
+		return stderr.Write(p)
+	default:
+		return len(p), nil
+	}
+}
+
+// pruneForSpace moves backups from files to remove, oldest first, until the
+// free space on the log file's filesystem reaches the low watermark, counting
+// the backups already due for removal as freed.  Backups on another
+// filesystem, such as an archive directory on another mount, don't free any
+// space there, so they are left alone.  It returns the remaining files and the
+// new list to remove.
+func (l *loggerOption) pruneForSpace(files []logInfo, remove []plannedFile) ([]logInfo, []plannedFile) {
+	target := l.lowWatermark
+	if target < l.criticalWatermark {
+		target = l.criticalWatermark
+	}
+
+	dir := l.dir()
+	free, err := freeSpace(dir)
+	if err != nil {
+		return files, remove
+	}
+	dev, err := deviceOf(dir)
+	if err != nil {
+		return files, remove
+	}
+	local := make(map[string]bool)
+	isLocal := func(f logInfo) bool {
+		same, ok := local[f.dir]
+		if !ok {
+			d, err := deviceOf(f.dir)
+			same = err == nil && d == dev
+			local[f.dir] = same
+		}
+		return same
+	}
+
+	for _, f := range remove {
+		if isLocal(f.logInfo) {
+			free += uint64(f.Size())
+		}
+	}
+
+	pruned := make(map[int]bool)
+	for i := len(files) - 1; i >= 0 && free < target; i-- {
+		f := files[i]
+		if !isLocal(f) {
+			continue
+		}
+		pruned[i] = true
+		remove = append(remove, plannedFile{f, ReasonDiskSpace})
+		free += uint64(f.Size())
+	}
+
+	kept := make([]logInfo, 0, len(files)-len(pruned))
+	for i, f := range files {
+		if !pruned[i] {
+			kept = append(kept, f)
+		}
+	}
+	return kept, remove
+}
+
+// report passes err to the error handler, or writes it to stderr if there is
+// none.
+func (l *loggerOption) report(err error) {
+	if l.errorHandler != nil {
+		l.errorHandler(err)
+		return
+	}
+	fmt.Fprintf(stderr, "lumberjack: %v\n", err) // nolint
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package lumberjack
+
+import "errors"
+
+// diskFree is only supported on linux, so free space watermarks are ignored
+// elsewhere.
+func diskFree(_ string) (uint64, error) {
+	return 0, errors.New("free disk space is not supported on this platform")
+}
+
+// diskDevice is only needed alongside diskFree, so it isn't supported
+// elsewhere either.
+func diskDevice(_ string) (uint64, error) {
+	return 0, errors.New("filesystem devices are not supported on this platform")
+}
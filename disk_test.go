@@ -0,0 +1,237 @@
+package lumberjack
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFree is the free space reported by fakeFreeSpace.
+var fakeFree uint64
+
+func fakeFreeSpace(_ string) (uint64, error) {
+	return fakeFree, nil
+}
+
+func TestDiskLowWatermark(t *testing.T) {
+	currentTime = fakeTime
+	freeSpace = fakeFreeSpace
+	defer func() { freeSpace = diskFree }()
+	fakeFree = 1000
+
+	dir := makeTempDir("TestDiskLowWatermark", t)
+	defer os.RemoveAll(dir) // nolint
+
+	var reported []error
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBytes(10),
+		WithDiskWatermarks(100, 10),
+		WithErrorHandler(func(err error) { reported = append(reported, err) }),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	var backups []string
+	for _, b := range []string{"foooooo!", "baaaaar!", "baaaaaz!", "bye!!"} {
+		newFakeTime()
+		_, err = l.Write([]byte(b))
+		require.NoError(t, err)
+		backups = append(backups, backupFile(dir))
+	}
+	backups = backups[1:]
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+	fileCount(dir, 4, t)
+	require.Empty(t, reported)
+
+	// freeing up two of the three backups brings us back over the watermark.
+	fakeFree = 85
+	newFakeTime()
+	_, err = l.Write([]byte("!!"))
+	require.NoError(t, err)
+
+	<-time.After(10 * time.Millisecond)
+	notExist(backups[0], t)
+	notExist(backups[1], t)
+	existsWithContent(backups[2], []byte("baaaaaz!"), t)
+	existsWithContent(filename, []byte("bye!!!!"), t)
+
+	require.Equal(t, []error{&DiskSpaceError{
+		Dir:       dir,
+		Free:      85,
+		Watermark: 100,
+	}}, reported)
+}
+
+func TestDiskCriticalWatermark(t *testing.T) {
+	currentTime = fakeTime
+	freeSpace = fakeFreeSpace
+	defer func() { freeSpace = diskFree }()
+	fakeFree = 5
+
+	dir := makeTempDir("TestDiskCriticalWatermark", t)
+	defer os.RemoveAll(dir) // nolint
+
+	var reported []error
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithDiskWatermarks(100, 10),
+		WithErrorHandler(func(err error) { reported = append(reported, err) }),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	newFakeTime()
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+	existsWithContent(filename, []byte{}, t)
+
+	require.Len(t, reported, 1)
+	require.EqualError(t, reported[0], "free space in "+dir+
+		" is 5 bytes, below the critical watermark of 10 bytes")
+
+	// writing resumes once there is space again.
+	fakeFree = 1000
+	newFakeTime()
+	n, err = l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+	existsWithContent(filename, b, t)
+	require.Len(t, reported, 1)
+}
+
+func TestDegraded(t *testing.T) {
+	currentTime = fakeTime
+	freeSpace = fakeFreeSpace
+	defer func() { freeSpace = diskFree }()
+	fakeFree = 5
+
+	var buf bytes.Buffer
+	stderr = &buf
+	defer func() { stderr = os.Stderr }()
+
+	tests := []struct {
+		name     string
+		opts     []LoggerOption
+		want     string
+		wantErrs string
+	}{
+		{"drop", []LoggerOption{WithDegraded(DegradedDrop)}, "", ""},
+		{"sample", []LoggerOption{WithDegraded(DegradedSample), WithSampleRate(2)}, "a\nc\n", ""},
+		{"stderr", []LoggerOption{WithDegraded(DegradedStderr)}, "", "a\nb\nc\n"},
+	}
+
+	for _, test := range tests {
+		buf.Reset()
+		dir := makeTempDir("TestDegraded", t)
+		filename := logFile(dir)
+
+		// the watermark is reported elsewhere rather than to stderr.
+		l, err := New(append(test.opts,
+			WithFileName(filename),
+			WithDiskWatermarks(0, 10),
+			WithErrorHandler(func(error) {}),
+		)...)
+		require.NoError(t, err, test.name)
+
+		for _, b := range []string{"a\n", "b\n", "c\n"} {
+			n, err := l.Write([]byte(b))
+			require.NoError(t, err, test.name)
+			require.Equal(t, len(b), n, test.name)
+		}
+		require.NoError(t, l.Close(), test.name)
+
+		existsWithContent(filename, []byte(test.want), t)
+		require.Equal(t, test.wantErrs, buf.String(), test.name)
+		os.RemoveAll(dir) // nolint
+	}
+}
+
+func TestDiskReportStderr(t *testing.T) {
+	currentTime = fakeTime
+	freeSpace = fakeFreeSpace
+	defer func() { freeSpace = diskFree }()
+	fakeFree = 5
+
+	var buf bytes.Buffer
+	stderr = &buf
+	defer func() { stderr = os.Stderr }()
+
+	dir := makeTempDir("TestDiskReportStderr", t)
+	defer os.RemoveAll(dir) // nolint
+
+	// without an error handler, the watermark is reported to stderr.
+	l, err := New(
+		WithFileName(logFile(dir)),
+		WithDiskWatermarks(100, 10),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	_, err = l.Write([]byte("boo!"))
+	require.NoError(t, err)
+	require.Equal(t, "lumberjack: free space in "+dir+
+		" is 5 bytes, below the critical watermark of 10 bytes\n", buf.String())
+}
+
+func TestDiskWatermarkOtherFilesystem(t *testing.T) {
+	currentTime = fakeTime
+	freeSpace = fakeFreeSpace
+	defer func() { freeSpace = diskFree }()
+	fakeFree = 1000
+
+	dir := makeTempDir("TestDiskWatermarkOtherFilesystem", t)
+	defer os.RemoveAll(dir) // nolint
+
+	// the archive directory is on another filesystem.
+	archive := filepath.Join(dir, "archive")
+	deviceOf = func(dir string) (uint64, error) {
+		if dir == archive {
+			return 2, nil
+		}
+		return 1, nil
+	}
+	defer func() { deviceOf = diskDevice }()
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithArchiveDir(archive),
+		WithMaxBytes(10),
+		WithDiskWatermarks(100, 10),
+		WithErrorHandler(func(error) {}),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	var backups []string
+	for _, b := range []string{"foooooo!", "baaaaar!", "baaaaaz!"} {
+		newFakeTime()
+		_, err = l.Write([]byte(b))
+		require.NoError(t, err)
+		backups = append(backups, backupFile(archive))
+	}
+	backups = backups[1:]
+
+	// removing the archived backups wouldn't free any space on the log
+	// file's filesystem, so they are kept.
+	fakeFree = 85
+	newFakeTime()
+	_, err = l.Write([]byte("!!"))
+	require.NoError(t, err)
+
+	<-time.After(10 * time.Millisecond)
+	existsWithContent(backups[0], []byte("foooooo!"), t)
+	existsWithContent(backups[1], []byte("baaaaar!"), t)
+}
@@ -184,10 +184,48 @@ func TestCompressMaintainOwner(t *testing.T) {
 	<-time.After(10 * time.Millisecond)
 
 	// a compressed version of the log file should now exist with the correct
-	// owner.
+	// owner, which was set on the temporary file it was renamed from.
 	filename2 := backupFile(dir)
-	require.Equal(t, 555, fakeFS.files[filename2+compressSuffix].uid)
-	require.Equal(t, 666, fakeFS.files[filename2+compressSuffix].gid)
+	exists(filename2+compressSuffix, t)
+	require.Equal(t, 555, fakeFS.files[filename2+compressSuffix+compressTmpSuffix].uid)
+	require.Equal(t, 666, fakeFS.files[filename2+compressSuffix+compressTmpSuffix].gid)
+}
+
+func TestSymlink(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestSymlink", t)
+	defer os.RemoveAll(dir) // nolint
+
+	link := filepath.Join(dir, "current")
+	dated := func() string {
+		return filepath.Join(dir, fakeTime().UTC().Format("20060102"), "foobar.log")
+	}
+
+	l, err := New(
+		WithFilePattern(filepath.Join(dir, "%Y%m%d", "foobar.log")),
+		WithSymlink(link),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+	existsWithContent(link, b, t)
+
+	newFakeTime()
+
+	b2 := []byte("foo!")
+	n, err = l.Write(b2)
+	require.NoError(t, err)
+	require.Equal(t, len(b2), n)
+	existsWithContent(link, b2, t)
+
+	target, err := os.Readlink(link)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(filepath.Base(filepath.Dir(dated())), "foobar.log"), target)
+	notExist(link+".tmp", t)
 }
 
 type fakeFile struct {
@@ -218,3 +256,15 @@ func (fs *fakeFS) Stat(name string) (os.FileInfo, error) {
 	stat.Gid = 666
 	return info, nil
 }
+
+func TestDiskFree(t *testing.T) {
+	dir := makeTempDir("TestDiskFree", t)
+	defer os.RemoveAll(dir) // nolint
+
+	free, err := diskFree(dir)
+	require.NoError(t, err)
+	require.NotZero(t, free)
+
+	_, err = diskFree(filepath.Join(dir, "missing"))
+	require.Error(t, err)
+}
@@ -23,7 +23,7 @@ package lumberjack
 
 import (
 	"bufio"
-	"compress/gzip"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -31,17 +31,27 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	backupTimeFormat = "2006-01-02T15-04-05.000"
 	compressSuffix   = ".gz"
+
+	// compressTmpSuffix is added to the name of a compressed file while it is
+	// being written.
+	compressTmpSuffix = ".tmp"
 )
 
+// maxPartial is the largest incomplete record held in record mode when there
+// is no maximum file size.
+const maxPartial = 1 * MB
+
 const (
 	// KB ...
 	KB = 1024 << (10 * iota)
@@ -79,16 +89,38 @@ type Writer interface {
 // `/var/log/foo/server.log`, a backup created at 6:30pm on Nov 11 2016 would
 // use the filename `/var/log/foo/server-2016-11-04T18-30-00.000.log`
 //
+// A backup format can replace this naming with a template, such as
+// `{dir}/{prefix}.{time:20060102-150405}.{seq}{ext}`, which is also used to
+// recognize the backups when cleaning up.
+//
+// With numbered backups, the backups are instead named `name.ext.N` where N
+// is 1 for the most recent backup.  On every rotation the existing backups are
+// renumbered one up, so `/var/log/foo/server.log.1` becomes
+// `/var/log/foo/server.log.2`, and the current file becomes
+// `/var/log/foo/server.log.1`.  Numbered backups are aged by the last time they
+// were written.
+//
 // Cleaning Up Old Log Files
 //
 // Whenever a new logfile gets created, old log files may be deleted.  The most
 // recent files according to the encoded timestamp will be retained, up to a
 // number equal to MaxBackups (or all of them if MaxBackups is 0).  Any files
 // with an encoded timestamp older than MaxAge days are deleted, regardless of
-// MaxBackups.  Note that the time encoded in the timestamp is the rotation
-// time, which may differ from the last time that file was written to.
+// MaxBackups.  Age limits can also be set as a duration, or as a number of
+// calendar days or months in a given time zone.  Note that the time encoded in
+// the timestamp is the rotation time, which may differ from the last time that
+// file was written to.
 //
-// If MaxBackups and MaxAge are both 0, no old log files will be deleted.
+// With a total size budget, the oldest backups are also deleted until all of
+// them and the current log file fit within it.  The newest MinBackups backups
+// are kept regardless of their age and the total size budget.
+//
+// When the free space on the log file's filesystem falls below the low
+// watermark, the oldest backups are deleted until there is enough space again,
+// regardless of the other limits.
+//
+// If MaxBackups, MaxAge, the total size budget and the watermarks are all 0,
+// no old log files will be deleted.
 type loggerOption struct {
 	// filename is the file to write logs to.  Backup log files will be retained
 	// in the same directory.  It uses <processname>-lumberjack.log in
@@ -106,28 +138,201 @@ type loggerOption struct {
 	// based on age.
 	maxDays int
 
+	// maxAge is the maximum age of old log files to retain, for limits finer
+	// than a day.  The default is not to remove old log files based on age.
+	maxAge time.Duration
+
+	// maxCalendarDays and maxCalendarMonths are the number of calendar days
+	// or months, counting the current one, to retain old log files for.  The
+	// calendar is that of retentionLocation, which defaults to the location
+	// used for timestamps.  The default is not to remove old log files based
+	// on age.
+	maxCalendarDays   int
+	maxCalendarMonths int
+	retentionLocation *time.Location
+
+	// ageByModTime determines if backups are aged by the last time they were
+	// written rather than by the time in their name, so that backups renamed
+	// or copied by other tools are aged correctly.
+	ageByModTime bool
+
+	// legacyBackups is a glob matching backups from another naming scheme,
+	// such as `/var/log/app/app.log.*`, which are aged by the last time they
+	// were written and cleaned up along with the others, but never
+	// compressed.
+	legacyBackups string
+
+	// dryRun determines if cleaning up old log files only reports what it
+	// would do to planHandler, or to stderr if that is nil, instead of doing
+	// it.
+	dryRun      bool
+	planHandler func(RetentionPlan)
+
 	// maxBackups is the maximum number of old log files to retain.  The default
 	// is to retain all old log files (though MaxAge may still cause them to get
 	// deleted.)
 	maxBackups int
 
+	// maxTotalBytes is the maximum number of bytes that the backups and the
+	// current log file may take up together.  The oldest backups are deleted
+	// until they fit.  The default is not to limit their total size.
+	maxTotalBytes int64
+
+	// minBackups is the number of the newest backups that are kept regardless
+	// of their age and the total size budget, so that some history survives
+	// a long outage.  It doesn't override maxBackups or the free space
+	// watermarks.  The default is not to keep any.
+	minBackups int
+
 	// localTime determines if the time used for formatting the timestamps in
 	// backup files is the computer's local time.  The default is to use UTC
 	// time.
 	localTime bool
 
+	// numbered determines if backups are named like logrotate's, by appending
+	// a number to the log file name that is shifted up on every rotation.
+	// The default is to name backups by their rotation time.
+	numbered bool
+
+	// archiveDir is the directory that backups are moved to, which may be on
+	// another device.  The default is the directory of the log file.
+	archiveDir string
+
+	// partition is the time layout of the subdirectories that backups are
+	// filed into by their rotation time, such as "2006/01/02".
+	partition string
+
+	// filePattern computes the file to write logs to from the current time,
+	// such as `/var/log/app/%Y/%m/%d/app.log`, switching to a new file when its
+	// value changes.  It takes precedence over filename.
+	filePattern string
+	pattern     *filePattern
+
+	// symlink is kept pointing at the open log file, so that tools following
+	// it don't lose track when the file changes.  The default is no symlink.
+	symlink string
+
+	// current is the name of the open log file.  It is read by the mill
+	// goroutine, so it is kept in an atomic.Value.
+	current atomic.Value
+
+	// backupFormat is a template for the names of backups, such as
+	// `{dir}/{prefix}.{time:20060102-150405}.{seq}{ext}`.  The default is
+	// `{dir}/{prefix}-{time:2006-01-02T15-04-05.000}{ext}`.
+	backupFormat string
+	template     *backupTemplate
+
 	// compress determines if the rotated log files should be compressed
-	// using gzip. The default is not to perform compression.
-	compress bool
+	// using compressor, which defaults to gzip. The default is not to
+	// perform compression.
+	compress   bool
+	compressor Compressor
+
+	// compressLevel, if set, is the level the compressor compresses at.  It
+	// only applies to the built-in compressors.
+	compressLevel *int
+
+	// delayCompress is the number of the newest backups that are left
+	// uncompressed, like logrotate's delaycompress, so that a process still
+	// writing to a rotated file or someone reading it isn't affected.  The
+	// default is to compress every backup.
+	delayCompress int
+
+	// stream determines if the active file is compressed as it is written,
+	// with one member per flush, so there is never an uncompressed file on
+	// disk.  The active file and its backups get the compressor's suffix,
+	// and the compressor must be gzip, whose members can be concatenated.
+	// Sizes count the bytes written, before compression.
+	stream   bool
+	streamer *streamWriter
+
+	// compressWorkers is the number of backups compressed in parallel.  The
+	// mill waits for them all before its next run, and rotations in the
+	// meantime only ask for one more run, so compression work never piles
+	// up.  The default is to compress one backup at a time.
+	compressWorkers int
 
 	rewrite bool
 
-	size    int64
-	file    *os.File
-	buf     *bufio.Writer
-	bufSize int
-	mu      sync.Mutex
-
+	// rotateOnOpen determines if an existing log file is moved aside to a
+	// backup when the logger is created, so that each run starts with a new
+	// file.  The default is to append to the existing file.
+	rotateOnOpen bool
+
+	// schedule determines the wall-clock times at which the log file is
+	// rotated, in addition to any size limit.  The default is to only rotate
+	// on size.
+	schedule Schedule
+
+	// nextRotation is the next time at which the schedule will rotate the log
+	// file, or the zero time if there is none.
+	nextRotation time.Time
+
+	// policy decides whether to rotate the log file before a write, in
+	// addition to the size limit and the schedule.
+	policy RotationPolicy
+
+	// oversize determines what happens to a write larger than maxBytes.  The
+	// default is to reject it with an error.
+	oversize Oversize
+
+	// maxLines is the maximum number of lines in the log file before it gets
+	// rotated.  The default is not to limit the number of lines.
+	maxLines int64
+
+	// records determines if writes are buffered until the record delimiter,
+	// so that a record is never split across two files.
+	records bool
+
+	// delimiter terminates each record in record mode.  It defaults to a
+	// newline.
+	delimiter byte
+
+	// lowWatermark is the number of free bytes on the log file's filesystem
+	// below which backups are pruned beyond the normal retention until there
+	// is enough space again.  The default is not to check the free space.
+	lowWatermark uint64
+
+	// criticalWatermark is the number of free bytes on the log file's
+	// filesystem below which writes are handled according to degraded
+	// instead of going to the log file.
+	criticalWatermark uint64
+
+	// degraded determines what happens to writes below the critical
+	// watermark.  The default is to drop them.
+	degraded Degraded
+
+	// sampleRate is how many writes DegradedSample keeps one of.
+	sampleRate int
+
+	// errorHandler is told about conditions such as the free space falling
+	// below a watermark, which are otherwise written to stderr.  It is called
+	// while the logger is locked, so it must not write to it.
+	errorHandler func(error)
+
+	diskLevel   diskLevel
+	diskChecked time.Time
+	sampled     int
+
+	size      int64
+	lines     int64
+	opened    time.Time
+	lastWrite time.Time
+	partial   []byte
+	file      *os.File
+	buf       *bufio.Writer
+	bufSize   int
+	mu        sync.Mutex
+
+	// millMu serializes the renaming of numbered backups with planning and
+	// removing backups, and with putting each compressed backup in place.
+	// It isn't held while compressing, so rotations don't wait for it.
+	millMu sync.Mutex
+
+	// compressing maps the backups being compressed, by the name they were
+	// opened under, to the name they have now, which changes if they are
+	// renumbered meanwhile.  It is guarded by millMu.
+	compressing map[string]string
 	millCh chan bool
 	cancel context.CancelFunc
 }
@@ -138,12 +343,27 @@ var (
 
 	// Stat exists so it can be mocked out by tests.
 	Stat = os.Stat
+
+	// rename exists so it can be mocked out by tests.
+	rename = os.Rename
 )
 
 // Write implements io.Writer.  If a write would cause the log file to be larger
 // than MaxSize, the file is closed, renamed to include a timestamp of the
 // current time, and a new log file is created using the original log file name.
-// If the length of the write is greater than MaxSize, an error is returned.
+// The same happens if a rotation schedule is configured and its next rotation
+// time has passed, or if the rotation policy asks for it.  If MaxLines is set,
+// the write is split at line boundaries so that each file holds exactly
+// MaxLines lines.  If the length of the write is greater than MaxSize, it is
+// handled according to the Oversize policy, which by default returns an error.
+//
+// If record mode is enabled, data is only written out once its record
+// delimiter has been written, and the file is only rotated between records, so
+// that no record is ever split across two files.
+//
+// If free space watermarks are set, the free space on the log file's
+// filesystem is checked first.  Below the critical watermark, writes are
+// dropped, sampled or sent to stderr according to the Degraded mode.
 func (l *loggerOption) Write(p []byte) (n int, err error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -152,13 +372,145 @@ func (l *loggerOption) Write(p []byte) (n int, err error) {
 		return 0, errors.New("file close")
 	}
 
+	l.checkDisk()
+	if l.diskLevel == diskCritical {
+		return l.writeDegraded(p)
+	}
+
+	if l.records {
+		return l.writeRecords(p)
+	}
+	return l.writeAll(p)
+}
+
+// writeRecords adds p to the pending partial record and writes out every
+// complete record, one at a time, so that the log file is only ever rotated
+// on record boundaries.  The last incomplete record stays pending until its
+// delimiter is written or the logger is closed, unless it grows larger than
+// MaxSize (or maxPartial without one).  It is then written out as it is,
+// according to the Oversize policy, and dropped if that fails, so that a
+// missing delimiter can't make it grow without bound.
+func (l *loggerOption) writeRecords(p []byte) (n int, err error) {
+	pending := len(l.partial)
+	data := append(l.partial, p...)
+
+	end := bytes.LastIndexByte(data, l.delimiter) + 1
+	written := 0
+	for written < end {
+		i := bytes.IndexByte(data[written:end], l.delimiter)
+		m, err := l.writeRecord(data[written : written+i+1])
+		written += m
+		if err != nil {
+			l.partial = append(data[:0], data[written:]...)
+			if written < pending {
+				return 0, err
+			}
+			return written - pending, err
+		}
+	}
+
+	l.partial = append(data[:0], data[end:]...)
+
+	limit := l.maxBytes
+	if limit <= 0 {
+		limit = maxPartial
+	}
+	if int64(len(l.partial)) > limit {
+		partial := l.partial
+		l.partial = nil
+		if _, err := l.writeRecord(partial); err != nil {
+			// whatever of p was in the dropped record wasn't written.
+			if len(partial) > len(p) {
+				return 0, err
+			}
+			return len(p) - len(partial), err
+		}
+	}
+	return len(p), nil
+}
+
+// writeRecord writes the record p to the log file whole.  If MaxLines is set
+// and p would take the log file past it, the file is rotated first instead of
+// splitting p across two files, so a record with more than MaxLines lines gets
+// a file of its own.
+func (l *loggerOption) writeRecord(p []byte) (n int, err error) {
+	if l.maxLines > 0 && l.lines > 0 && l.lines+countLines(p) > l.maxLines {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	return l.write(p)
+}
+
+// writeAll writes p to the log file, splitting it at line boundaries if
+// MaxLines is set.
+func (l *loggerOption) writeAll(p []byte) (n int, err error) {
+	if l.maxLines > 0 {
+		return l.writeLines(p)
+	}
+	return l.write(p)
+}
+
+// writeLines writes p in chunks that each fill the current log file up to
+// MaxLines lines, rotating in between, so that every file holds exactly
+// MaxLines lines.
+func (l *loggerOption) writeLines(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		if l.lines >= l.maxLines {
+			if err := l.rotate(); err != nil {
+				return n, err
+			}
+		}
+
+		end := len(p)
+		if i := indexLine(p, l.maxLines-l.lines); i >= 0 {
+			end = i + 1
+		}
+
+		m, err := l.write(p[:end])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[end:]
+	}
+	return n, nil
+}
+
+// indexLine returns the index of the nth newline in p, or -1 if p holds fewer
+// newlines.
+func indexLine(p []byte, nth int64) int {
+	offset := 0
+	for ; nth > 0; nth-- {
+		i := bytes.IndexByte(p[offset:], '\n')
+		if i < 0 {
+			return -1
+		}
+		offset += i + 1
+	}
+	return offset - 1
+}
+
+// write writes p to the current log file, rotating it first if any of the
+// rotation rules asks for it.
+func (l *loggerOption) write(p []byte) (n int, err error) {
+	if l.pattern != nil && l.activePath(l.name()) != l.current.Load() {
+		if err := l.switchFile(); err != nil {
+			return 0, err
+		}
+	}
+
+	if l.rotationDue(currentTime()) {
+		if err := l.rotateDue(l.nextRotation); err != nil {
+			return 0, err
+		}
+	}
+
 	if l.maxBytes > 0 {
 		writeLen := int64(len(p))
 
 		if writeLen > l.maxBytes {
-			return 0, fmt.Errorf(
-				"write length %d exceeds maximum file size %d", writeLen, l.maxBytes,
-			)
+			return l.writeOversize(p)
 		}
 
 		if l.size+writeLen > l.maxBytes {
@@ -168,14 +520,46 @@ func (l *loggerOption) Write(p []byte) (n int, err error) {
 		}
 	}
 
+	if l.policy != nil && l.policy.ShouldRotate(l.state(p)) {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	return l.writeFile(p)
+}
+
+// writeFile writes p to the current log file without any rotation checks.
+func (l *loggerOption) writeFile(p []byte) (n int, err error) {
 	n, err = l.buf.Write(p)
 	if err == nil {
 		l.size += int64(n)
+		l.lines += countLines(p)
+		l.lastWrite = currentTime()
 	}
 
 	return n, err
 }
 
+// switchFile closes the current log file and opens the one the file pattern
+// now names, leaving the old one in place as a backup.
+func (l *loggerOption) switchFile() error {
+	if err := l.close(); err != nil {
+		return err
+	}
+	if err := l.openExistingOrNew(); err != nil {
+		return err
+	}
+	// mill again now that the old file is no longer the current one.
+	l.mill()
+	return nil
+}
+
+// countLines returns the number of newlines in p.
+func countLines(p []byte) int64 {
+	return int64(bytes.Count(p, []byte{'\n'}))
+}
+
 // isClose check file and buffer.
 func (l *loggerOption) isClose() bool {
 	return l.file == nil && l.buf == nil
@@ -186,26 +570,36 @@ func (l *loggerOption) Close() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	l.cancel()
+
+	// write out the last incomplete record rather than losing it.
+	if len(l.partial) > 0 && !l.isClose() {
+		if _, err := l.writeAll(l.partial); err != nil {
+			l.close() // nolint
+			return err
+		}
+		l.partial = nil
+	}
+
 	return l.close()
 }
 
 func (l *loggerOption) Flush() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	return l.buf.Flush()
+	return l.flush()
 }
 
 // close closes the file if it is open.
 func (l *loggerOption) close() error {
 	defer func() {
-		l.file, l.buf = nil, nil
+		l.file, l.buf, l.streamer = nil, nil, nil
 	}()
 
 	if l.isClose() {
 		return nil
 	}
 
-	if err := l.buf.Flush(); err != nil {
+	if err := l.flush(); err != nil {
 		return err
 	}
 
@@ -246,23 +640,33 @@ func (l *loggerOption) openNew() error {
 	}
 
 	name := l.name()
-	info, err := Stat(name)
+	path := l.activePath(name)
+	base := l.partitionBase(name, l.timeIn(currentTime()))
+	if err := os.MkdirAll(filepath.Dir(base), 0750); err != nil {
+		return fmt.Errorf("can't make archive directory: %s", err)
+	}
+
+	info, err := Stat(path)
 
 	if err == nil && l.rewrite {
-		if err := os.Remove(name); err != nil {
+		if err := os.Remove(path); err != nil {
 			return fmt.Errorf("can't remove log file: %s", err)
 		}
 	}
 
 	if err == nil && !l.rewrite {
 		// move the existing file
-		newname := backupName(name, l.localTime)
-		if err := os.Rename(name, newname); err != nil {
+		if l.numbered {
+			err = l.shiftBackups(name)
+		} else {
+			err = moveFile(path, l.newBackupName(base))
+		}
+		if err != nil {
 			return fmt.Errorf("can't rename log file: %s", err)
 		}
 
 		// this is a no-op anywhere but linux
-		if err := chown(name, info); err != nil {
+		if err := chown(path, info); err != nil {
 			return err
 		}
 	}
@@ -271,20 +675,65 @@ func (l *loggerOption) openNew() error {
 	// the file ourselves. if someone else creates the file in the meantime,
 	// just wipe out the contents.
 	mode := os.FileMode(0600)                                                // nolint
-	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode) // nolint
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode) // nolint
 	if err != nil {
 		return fmt.Errorf("can't open new logfile: %s", err)
 	}
+	if err := l.updateSymlink(path); err != nil {
+		file.Close() // nolint
+		return err
+	}
 	l.file = file
+	l.current.Store(path)
 	l.size = 0
-	l.buf = bufio.NewWriterSize(file, l.bufSize)
+	l.lines = 0
+	l.opened = currentTime()
+	l.lastWrite = time.Time{}
+	l.setBuffer(file)
+	return nil
+}
+
+// newBackupName returns the name to move the named log file to, from the
+// backup template if there is one, with the suffix of the active file.
+func (l *loggerOption) newBackupName(name string) string {
+	suffix := l.streamSuffix()
+	if l.template != nil {
+		return l.template.backupName(name, l.timeIn(currentTime()), l.backupTaken) + suffix
+	}
+	return backupName(name, suffix, l.localTime, l.backupTaken)
+}
+
+// updateSymlink points the symlink at the named log file, if there is one.  The
+// new link is created under a temporary name and renamed over the old one, so
+// the symlink never dangles or goes missing.
+func (l *loggerOption) updateSymlink(name string) error {
+	if l.symlink == "" {
+		return nil
+	}
+
+	target := name
+	if rel, err := filepath.Rel(filepath.Dir(l.symlink), name); err == nil {
+		target = rel
+	}
+
+	tmp := l.symlink + ".tmp"
+	os.Remove(tmp) // nolint
+	if err := os.Symlink(target, tmp); err != nil {
+		return fmt.Errorf("can't create symlink: %s", err)
+	}
+	if err := os.Rename(tmp, l.symlink); err != nil {
+		os.Remove(tmp) // nolint
+		return fmt.Errorf("can't replace symlink: %s", err)
+	}
 	return nil
 }
 
 // backupName creates a new filename from the given name, inserting a timestamp
 // between the filename and the extension, using the local time if requested
-// (otherwise UTC).
-func backupName(name string, local bool) string {
+// (otherwise UTC).  If a backup with that timestamp already exists, compressed
+// or not, because of two rotations within the same millisecond, a sequence
+// number is appended to the timestamp, as in `name-timestamp-1.ext`.
+func backupName(name, suffix string, local bool, taken func(string) bool) string {
 	dir := filepath.Dir(name)
 	filename := filepath.Base(name)
 	ext := filepath.Ext(filename)
@@ -295,17 +744,24 @@ func backupName(name string, local bool) string {
 	}
 
 	timestamp := t.Format(backupTimeFormat)
-	return filepath.Join(dir, fmt.Sprintf("%s-%s%s", prefix, timestamp, ext))
+	newname := filepath.Join(dir, fmt.Sprintf("%s-%s%s", prefix, timestamp, ext))
+	// a backup that has since been compressed holds the name as well.
+	for seq := 1; taken(newname); seq++ {
+		newname = filepath.Join(dir, fmt.Sprintf("%s-%s-%d%s", prefix, timestamp, seq, ext))
+	}
+	return newname + suffix
 }
 
 // openExistingOrNew opens the logfile if it exists and if the current write
-// would not put it over MaxSize.  If there is no such file or the write would
-// put it over the MaxSize, a new file is created.
+// would not put it over MaxSize.  If there is no such file, the write would
+// put it over the MaxSize, a scheduled rotation time has passed since the
+// file was last written, or RotateOnOpen is set and the file isn't empty, a new
+// file is created.
 func (l *loggerOption) openExistingOrNew() error {
 	l.mill()
 
-	name := l.name()
-	info, err := Stat(name)
+	path := l.activePath(l.name())
+	info, err := Stat(path)
 	if os.IsNotExist(err) {
 		return l.openNew()
 	}
@@ -313,20 +769,85 @@ func (l *loggerOption) openExistingOrNew() error {
 		return fmt.Errorf("error getting log file info: %s", err)
 	}
 
-	file, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0600) // nolint
+	if l.rotateOnOpen && info.Size() > 0 {
+		return l.openNew()
+	}
+
+	if l.schedule != nil {
+		next := l.schedule.Next(l.timeIn(info.ModTime()))
+		if !next.IsZero() && !next.After(currentTime()) {
+			return l.openNew()
+		}
+	}
+
+	// only count the lines already in the file if something uses them.  A
+	// compressed file is always read through, since its size counts what was
+	// written to it, and new members may only be appended to a whole stream.
+	size := info.Size()
+	var lines int64
+	if l.stream && size > 0 {
+		if size, lines, err = l.countStream(path); err != nil {
+			return l.openNew()
+		}
+	} else if l.maxLines > 0 || l.policy != nil {
+		if lines, err = countFileLines(path); err != nil {
+			return l.openNew()
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600) // nolint
 	if err != nil {
 		// if we fail to open the old log file for some reason, just ignore
 		// it and open a new log file.
 		return l.openNew()
 	}
+	if err := l.updateSymlink(path); err != nil {
+		file.Close() // nolint
+		return err
+	}
 	l.file = file
-	l.size = info.Size()
-	l.buf = bufio.NewWriterSize(file, l.bufSize)
+	l.current.Store(path)
+	l.size = size
+	l.lines = lines
+	l.opened = currentTime()
+	l.lastWrite = info.ModTime()
+	l.setBuffer(file)
 	return nil
 }
 
+// countFileLines returns the number of newlines in the named file.
+func countFileLines(name string) (int64, error) {
+	f, err := os.Open(name) // nolint
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close() // nolint
+
+	_, lines, err := countReader(f)
+	return lines, err
+}
+
+// countReader returns the number of bytes and newlines read from r.
+func countReader(r io.Reader) (size, lines int64, err error) {
+	buf := make([]byte, 32*KB) // nolint
+	for {
+		n, err := r.Read(buf)
+		size += int64(n)
+		lines += countLines(buf[:n])
+		if err == io.EOF {
+			return size, lines, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
 // filename generates the name of the logfile from the current time.
 func (l *loggerOption) name() string {
+	if l.pattern != nil {
+		return l.pattern.format(l.timeIn(currentTime()))
+	}
 	if l.filename != "" {
 		return l.filename
 	}
@@ -337,18 +858,82 @@ func (l *loggerOption) name() string {
 // millRunOnce performs compression and removal of stale log files.
 // Log files are compressed if enabled via configuration and old log
 // files are removed, keeping at most l.MaxBackups files, as long as
-// none of them are older than MaxAge.
+// none of them are older than MaxAge and they fit in the total size budget.
+// In dry-run mode, the plan is only reported.
 func (l *loggerOption) millRunOnce() error {
-	if l.maxBackups == 0 && l.maxDays == 0 && !l.compress {
+	if l.maxBackups == 0 && l.ageCutoff(currentTime()).IsZero() && l.maxTotalBytes == 0 &&
+		l.lowWatermark == 0 && l.criticalWatermark == 0 && !l.compress {
 		return nil
 	}
 
+	compress, err := l.removeStale()
+	if errCompress := l.compressAll(compress); err == nil && errCompress != nil {
+		err = errCompress
+	}
+
+	return err
+}
+
+// removeStale plans what to do with the backups, removes those not kept and
+// returns those to compress.  It holds millMu throughout, so that numbered
+// backups aren't renamed between planning and removing.
+func (l *loggerOption) removeStale() ([]plannedFile, error) {
+	l.millMu.Lock()
+	defer l.millMu.Unlock()
+
+	compress, remove, err := l.planRetention()
+	if err != nil {
+		return nil, err
+	}
+
+	if l.dryRun {
+		l.reportPlan(newRetentionPlan(compress, remove))
+		return nil, nil
+	}
+
+	for _, f := range remove {
+		errRemove := os.Remove(f.path())
+		if err == nil && errRemove != nil {
+			err = errRemove
+		}
+		if l.pattern != nil {
+			removeEmptyDirs(f.dir, l.pattern.root())
+		}
+		if l.partitioned() {
+			removeEmptyDirs(f.dir, filepath.Dir(l.backupBase(l.name())))
+		}
+	}
+
+	return compress, err
+}
+
+// planRetention works out which backups to compress and which to remove, and
+// why, without touching any of them.  The caller must hold millMu.
+func (l *loggerOption) planRetention() (compress, remove []plannedFile, err error) {
 	files, err := l.oldLogFiles()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	var compress, remove []logInfo
+	// the files being compressed right now are left alone, so the others
+	// were left behind by a crash.  The backups they were made from are still
+	// there.
+	inflight := make(map[string]bool)
+	for src := range l.compressing {
+		inflight[src+l.compressor.Suffix()+compressTmpSuffix] = true
+	}
+	var remaining []logInfo
+	for _, f := range files {
+		if inflight[f.path()] {
+			continue
+		}
+		if f.interrupted {
+			remove = append(remove, plannedFile{f, ReasonInterrupted})
+		} else {
+			remaining = append(remaining, f)
+		}
+	}
+	files = remaining
 
 	if l.maxBackups > 0 && l.maxBackups < len(files) {
 		preserved := make(map[string]bool)
@@ -356,26 +941,24 @@ func (l *loggerOption) millRunOnce() error {
 		for _, f := range files {
 			// Only count the uncompressed log file or the
 			// compressed log file, not both.
-			preserved[strings.TrimSuffix(f.Name(), compressSuffix)] = true
+			preserved[l.trimCompressed(f.path())] = true
 
 			if len(preserved) > l.maxBackups {
-				remove = append(remove, f)
+				remove = append(remove, plannedFile{f, ReasonCount})
 			} else {
 				remaining = append(remaining, f)
 			}
 		}
 		files = remaining
-		fmt.Println(preserved)
 	}
 
-	if l.maxDays > 0 {
-		diff := time.Duration(int64(24*time.Hour) * int64(l.maxDays)) // nolint
-		cutoff := currentTime().Add(-1 * diff)
+	kept := l.newestBackups(files, l.minBackups)
 
+	if cutoff := l.ageCutoff(currentTime()); !cutoff.IsZero() {
 		var remaining []logInfo
 		for _, f := range files {
-			if f.timestamp.Before(cutoff) {
-				remove = append(remove, f)
+			if f.timestamp.Before(cutoff) && !kept[f.path()] {
+				remove = append(remove, plannedFile{f, ReasonAge})
 			} else {
 				remaining = append(remaining, f)
 			}
@@ -383,29 +966,57 @@ func (l *loggerOption) millRunOnce() error {
 		files = remaining
 	}
 
-	if l.compress {
+	if l.maxTotalBytes > 0 {
+		var total int64
+		current, _ := l.current.Load().(string)
+		if info, err := Stat(current); err == nil {
+			total = info.Size()
+		}
+
+		var remaining []logInfo
 		for _, f := range files {
-			if !strings.HasSuffix(f.Name(), compressSuffix) {
-				compress = append(compress, f)
+			total += f.Size()
+			if total > l.maxTotalBytes && !kept[f.path()] {
+				remove = append(remove, plannedFile{f, ReasonBudget})
+			} else {
+				remaining = append(remaining, f)
 			}
 		}
+		files = remaining
 	}
 
-	for _, f := range remove {
-		errRemove := os.Remove(filepath.Join(l.dir(), f.Name()))
-		if err == nil && errRemove != nil {
-			err = errRemove
-		}
+	if l.lowWatermark > 0 || l.criticalWatermark > 0 {
+		files, remove = l.pruneForSpace(files, remove)
 	}
-	for _, f := range compress {
-		fn := filepath.Join(l.dir(), f.Name())
-		errCompress := compressLogFile(fn, fn+compressSuffix)
-		if err == nil && errCompress != nil {
-			err = errCompress
+
+	if l.compress {
+		plain := l.newestBackups(files, l.delayCompress)
+		for _, f := range files {
+			if !f.legacy && !plain[f.path()] && !l.isCompressed(f.Name()) {
+				compress = append(compress, plannedFile{f, ReasonCompress})
+			}
 		}
 	}
 
-	return err
+	return compress, remove, nil
+}
+
+// newestBackups returns the paths of the newest n backups among files, which
+// are sorted newest first, counting a backup and its compressed copy as one.
+func (l *loggerOption) newestBackups(files []logInfo, n int) map[string]bool {
+	kept := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, f := range files {
+		name := l.trimCompressed(f.path())
+		if !seen[name] {
+			if len(seen) == n {
+				break
+			}
+			seen[name] = true
+		}
+		kept[f.path()] = true
+	}
+	return kept
 }
 
 // millRun runs in a goroutine to manage post-rotation compression and removal
@@ -423,55 +1034,158 @@ L:
 }
 
 // mill performs post-rotation compression and removal of stale log files,
-// starting the mill goroutine if necessary.
+// starting the mill goroutine if necessary.  If a run is already pending, that
+// run will see the current state, so there is no need to wait for it.
 func (l *loggerOption) mill() {
-	l.millCh <- true
+	select {
+	case l.millCh <- true:
+	default:
+	}
 }
 
 // oldLogFiles returns the list of backup log files stored in the same
-// directory as the current log file, sorted by ModTime.
+// directory as the current log file, or in the archive directory and its
+// partitions, sorted by ModTime.  With a file pattern, these are the files the
+// pattern generated before, and their backups.  Any files matching the legacy
+// backup glob are included too.
 func (l *loggerOption) oldLogFiles() ([]logInfo, error) {
-	files, err := ioutil.ReadDir(l.dir())
+	var logFiles []logInfo
+	if l.pattern != nil {
+		var err error
+		if logFiles, err = l.patternLogFiles(); err != nil {
+			return nil, err
+		}
+	} else {
+		base := l.backupBase(l.name())
+		dirs, err := l.archivedFiles(base)
+		if err != nil {
+			return nil, fmt.Errorf("can't read log file directory: %s", err)
+		}
+		logFiles = l.backupsAmong(base, dirs)
+	}
+
+	if l.legacyBackups != "" {
+		legacy, err := l.legacyLogFiles(logFiles)
+		if err != nil {
+			return nil, err
+		}
+		logFiles = append(logFiles, legacy...)
+	}
+
+	if l.ageByModTime {
+		for i := range logFiles {
+			logFiles[i].timestamp = logFiles[i].ModTime()
+		}
+	}
+
+	if l.numbered && l.pattern == nil && l.legacyBackups == "" {
+		sort.Sort(byNumber(logFiles))
+	} else {
+		sort.Sort(byFormatTime(logFiles))
+	}
+
+	return logFiles, nil
+}
+
+// backupsIn returns the backups derived from the named log file, which are
+// stored in the same directory.
+func (l *loggerOption) backupsIn(name string) ([]logInfo, error) {
+	files, err := ioutil.ReadDir(filepath.Dir(name))
 	if err != nil {
 		return nil, fmt.Errorf("can't read log file directory: %s", err)
 	}
+	return l.backupsOf(name, files), nil
+}
+
+// backupsOf returns the backups of the named log file among files, which are
+// in the same directory.
+func (l *loggerOption) backupsOf(name string, files []os.FileInfo) []logInfo {
 	logFiles := []logInfo{}
+	dir, base := filepath.Split(name)
+	dir = filepath.Clean(dir)
+	prefix, ext := prefixAndExtOf(name)
 
-	prefix, ext := l.prefixAndExt()
+	var re *regexp.Regexp
+	if l.template != nil {
+		re = l.template.regexp(base)
+	}
 
 	for _, f := range files {
 		if f.IsDir() {
 			continue
 		}
-		if t, err := l.timeFromName(f.Name(), prefix, ext); err == nil {
-			logFiles = append(logFiles, logInfo{t, f})
+		fname, interrupted := l.interruptedName(f.Name())
+		if l.template != nil {
+			if t, seq, err := l.template.parse(re, l.trimCompressed(fname), l.location()); err == nil {
+				logFiles = append(logFiles, logInfo{
+					timestamp: t, number: seq, dir: dir, interrupted: interrupted, FileInfo: f,
+				})
+			}
+			continue
+		}
+		if l.numbered {
+			// numbered backups carry no time, so they are aged by the
+			// last time they were written.
+			if n, err := l.numberFromName(fname, base); err == nil {
+				logFiles = append(logFiles, logInfo{
+					timestamp: f.ModTime(), number: n, dir: dir, interrupted: interrupted, FileInfo: f,
+				})
+			}
 			continue
 		}
-		if t, err := l.timeFromName(f.Name(), prefix, ext+compressSuffix); err == nil {
-			logFiles = append(logFiles, logInfo{t, f})
+		if t, seq, err := l.timeAndSeqFromName(l.trimCompressed(fname), prefix, ext); err == nil {
+			logFiles = append(logFiles, logInfo{
+				timestamp: t, number: seq, dir: dir, interrupted: interrupted, FileInfo: f,
+			})
 			continue
 		}
 		// error parsing means that the suffix at the end was not generated
 		// by lumberjack, and therefore it's not a backup file.
 	}
 
-	sort.Sort(byFormatTime(logFiles))
-
-	return logFiles, nil
+	return logFiles
 }
 
 // timeFromName extracts the formatted time from the filename by stripping off
 // the filename's prefix and extension. This prevents someone's filename from
 // confusing time.parse.
 func (l *loggerOption) timeFromName(filename, prefix, ext string) (time.Time, error) {
+	t, _, err := l.timeAndSeqFromName(filename, prefix, ext)
+	return t, err
+}
+
+// timeAndSeqFromName extracts the formatted time from the filename like
+// timeFromName, along with the sequence number that follows the time in the
+// names of colliding backups, which is 0 if there is none.
+func (l *loggerOption) timeAndSeqFromName(filename, prefix, ext string) (time.Time, int, error) {
 	if !strings.HasPrefix(filename, prefix) {
-		return time.Time{}, errors.New("mismatched prefix")
+		return time.Time{}, 0, errors.New("mismatched prefix")
 	}
 	if !strings.HasSuffix(filename, ext) {
-		return time.Time{}, errors.New("mismatched extension")
+		return time.Time{}, 0, errors.New("mismatched extension")
 	}
 	ts := filename[len(prefix) : len(filename)-len(ext)]
-	return time.Parse(backupTimeFormat, ts)
+
+	// every element of the time format is zero padded, so the time always
+	// has the length of the format.
+	seq := 0
+	if len(ts) > len(backupTimeFormat) {
+		suffix := ts[len(backupTimeFormat):]
+		if !strings.HasPrefix(suffix, "-") {
+			return time.Time{}, 0, errors.New("mismatched sequence number")
+		}
+		n, err := parseNumber(suffix[1:])
+		if err != nil {
+			return time.Time{}, 0, err
+		}
+		ts, seq = ts[:len(backupTimeFormat)], n
+	}
+
+	t, err := time.ParseInLocation(backupTimeFormat, ts, l.location())
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return t, seq, nil
 }
 
 // dir returns the directory for the current filename.
@@ -482,75 +1196,155 @@ func (l *loggerOption) dir() string {
 // prefixAndExt returns the filename part and extension part from the loggerOption's
 // filename.
 func (l *loggerOption) prefixAndExt() (prefix, ext string) {
-	filename := filepath.Base(l.name())
+	return prefixAndExtOf(l.name())
+}
+
+// prefixAndExtOf returns the filename part and extension part from the named
+// log file.
+func prefixAndExtOf(name string) (prefix, ext string) {
+	filename := filepath.Base(name)
 	ext = filepath.Ext(filename)
 	prefix = filename[:len(filename)-len(ext)] + "-"
 	return prefix, ext
 }
 
-// compressLogFile compresses the given log file, removing the
-// uncompressed log file if successful.
-func compressLogFile(src, dst string) (err error) {
+// compressLogFile compresses the given log file with the compressor, removing
+// the uncompressed log file if successful.  The compressed file is written
+// under a temporary name and only renamed once it is complete and synced, so
+// that a compressed backup is never a partial copy.  Whatever a crash leaves
+// behind is cleaned up by the next mill run, which then compresses the log
+// file again.
+//
+// millMu is only held while opening the log file and while putting the
+// compressed file in place.  If a rotation renumbers the log file meanwhile,
+// the compressed file follows it to its new name.
+func (l *loggerOption) compressLogFile(src string) (err error) {
+	l.millMu.Lock()
 	f, err := os.Open(src) // nolint
+	if err == nil {
+		if l.compressing == nil {
+			l.compressing = make(map[string]string)
+		}
+		l.compressing[src] = src
+	}
+	l.millMu.Unlock()
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %v", err)
 	}
 	defer f.Close() // nolint
+	defer func() {
+		l.millMu.Lock()
+		delete(l.compressing, src)
+		l.millMu.Unlock()
+	}()
 
 	file, err := Stat(src)
 	if err != nil {
 		return fmt.Errorf("failed to stat log file: %v", err)
 	}
 
-	if err := chown(dst, file); err != nil {
+	tmp := src + l.compressor.Suffix() + compressTmpSuffix
+	if err := chown(tmp, file); err != nil {
 		return fmt.Errorf("failed to chown compressed log file: %v", err)
 	}
 
-	// If this file already exists, we presume it was created by
-	// a previous attempt to compress the log file.
-	gzf, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, file.Mode()) // nolint
+	cf, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, file.Mode()) // nolint
 	if err != nil {
 		return fmt.Errorf("failed to open compressed log file: %v", err)
 	}
-	defer gzf.Close() // nolint
-
-	gz := gzip.NewWriter(gzf)
+	defer cf.Close() // nolint
 
 	defer func() {
 		if err != nil {
-			os.Remove(dst) // nolint
-			err = fmt.Errorf("failed to compress log file: %v", os.Remove(dst))
+			os.Remove(tmp) // nolint
+			err = fmt.Errorf("failed to compress log file: %v", err)
 		}
 	}()
 
-	if _, err := io.Copy(gz, f); err != nil {
+	cw, err := l.compressor.NewWriter(cf)
+	if err != nil {
 		return err
 	}
-	if err := gz.Close(); err != nil {
+	if _, err := io.Copy(cw, f); err != nil {
 		return err
 	}
-	if err := gzf.Close(); err != nil {
+	if err := cw.Close(); err != nil {
+		return err
+	}
+	if err := cf.Sync(); err != nil {
+		return err
+	}
+	if err := cf.Close(); err != nil {
 		return err
 	}
-
 	if err := f.Close(); err != nil {
 		return err
 	}
 
-	return os.Remove(src)
+	l.millMu.Lock()
+	defer l.millMu.Unlock()
+
+	current := l.compressing[src]
+	dst := current + l.compressor.Suffix()
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(dst))
+
+	return os.Remove(current)
+}
+
+// followRename records that a backup was renamed from oldpath to newpath, so
+// that if it is being compressed, the compressed file takes the new name.  The
+// caller must hold millMu.
+func (l *loggerOption) followRename(oldpath, newpath string) {
+	for src, current := range l.compressing {
+		if current == oldpath {
+			l.compressing[src] = newpath
+		}
+	}
+}
+
+// syncDir makes a rename in the named directory durable where that is
+// supported, and does nothing elsewhere.
+func syncDir(dir string) {
+	d, err := os.Open(dir) // nolint
+	if err != nil {
+		return
+	}
+	d.Sync()  // nolint
+	d.Close() // nolint
 }
 
 // logInfo is a convenience struct to return the filename and its embedded
-// timestamp.
+// timestamp, and its number for numbered backups or its sequence number for
+// colliding and templated ones.
 type logInfo struct {
 	timestamp time.Time
+	number    int
+	dir       string
+	legacy    bool
+
+	// interrupted is set for what an interrupted compression of the backup
+	// left behind.
+	interrupted bool
+
 	os.FileInfo
 }
 
-// byFormatTime sorts by newest time formatted in the name.
+// path returns the full name of the log file.
+func (l logInfo) path() string {
+	return filepath.Join(l.dir, l.Name())
+}
+
+// byFormatTime sorts by newest time formatted in the name, and then by highest
+// sequence number.
 type byFormatTime []logInfo
 
 func (b byFormatTime) Less(i, j int) bool {
+	if b[i].timestamp.Equal(b[j].timestamp) {
+		return b[i].number > b[j].number
+	}
 	return b[i].timestamp.After(b[j].timestamp)
 }
 
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime/pprof"
+	"strings"
 	"testing"
 	"time"
 
@@ -279,12 +280,13 @@ func TestMaxBackups(t *testing.T) { // nolint
 	// this will use the new fake time
 	fourthFilename := backupFile(dir)
 
-	// Create a log file that is/was being compressed - this should
-	// not be counted since both the compressed and the uncompressed
-	// log files still exist.
+	// Create a compressed backup with the same timestamp - the new backup
+	// must not take its name, or compressing it would overwrite this one.
 	compLogFile := fourthFilename + compressSuffix
 	err = ioutil.WriteFile(compLogFile, []byte("compress"), 0600)
 	require.NoError(t, err)
+	ext := filepath.Ext(fourthFilename)
+	fifthFilename := strings.TrimSuffix(fourthFilename, ext) + "-1" + ext
 
 	// this will make us rotate again
 	b4 := []byte("baaaaaaz!")
@@ -292,8 +294,8 @@ func TestMaxBackups(t *testing.T) { // nolint
 	require.NoError(t, err)
 	require.Equal(t, len(b4), n)
 
-	existsWithContent(fourthFilename, b3, t)
-	existsWithContent(fourthFilename+compressSuffix, []byte("compress"), t)
+	notExist(fourthFilename, t)
+	existsWithContent(fifthFilename, b3, t)
 
 	// we need to wait a little bit since the files get deleted on a different
 	// goroutine.
@@ -301,15 +303,16 @@ func TestMaxBackups(t *testing.T) { // nolint
 
 	// We should have four things in the directory now - the 2 log files, the
 	// not log file, and the directory
-	fileCount(dir, 5, t)
+	fileCount(dir, 4, t)
 
 	// third file name should still exist
 	existsWithContent(filename, b4, t)
 
-	existsWithContent(fourthFilename, b3, t)
+	existsWithContent(fifthFilename, b3, t)
 
-	// should have deleted the first filename
+	// should have deleted the older backups
 	notExist(thirdFilename, t)
+	notExist(compLogFile, t)
 
 	// the not-a-logfile should still exist
 	exists(notlogfile, t)
@@ -441,6 +444,104 @@ func TestMaxAge(t *testing.T) { // nolint
 	existsWithContent(backupFile(dir), b2, t)
 }
 
+func TestMaxTotalBytes(t *testing.T) {
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestMaxTotalBytes", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBytes(10),
+		WithMaxTotalBytes(15),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("foooooo!")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+
+	newFakeTime()
+	b2 := []byte("baaaaar!")
+	_, err = l.Write(b2)
+	require.NoError(t, err)
+	secondFilename := backupFile(dir)
+
+	newFakeTime()
+	b3 := []byte("baaaaaz!")
+	_, err = l.Write(b3)
+	require.NoError(t, err)
+	thirdFilename := backupFile(dir)
+
+	newFakeTime()
+	b4 := []byte("bye!!")
+	_, err = l.Write(b4)
+	require.NoError(t, err)
+	fourthFilename := backupFile(dir)
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(time.Millisecond * 10)
+
+	// only the newest backup fits in the budget along with the current file.
+	existsWithContent(filename, b4, t)
+	existsWithContent(fourthFilename, b3, t)
+	notExist(thirdFilename, t)
+	notExist(secondFilename, t)
+	fileCount(dir, 2, t)
+}
+
+func TestMinBackups(t *testing.T) {
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestMinBackups", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	opts := []LoggerOption{
+		WithFileName(filename),
+		WithMaxBytes(10),
+		WithMaxDays(1),
+		WithMinBackups(2),
+	}
+	l, err := New(opts...)
+	require.NoError(t, err)
+
+	var backups []string
+	for _, b := range []string{"foooooo!", "baaaaar!", "baaaaaz!", "bye!"} {
+		newFakeTime()
+		_, err = l.Write([]byte(b))
+		require.NoError(t, err)
+		backups = append(backups, backupFile(dir))
+	}
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+	require.NoError(t, l.Close())
+
+	// the oldest backup is past the cutoff, but the newer one is kept.
+	notExist(backups[1], t)
+	existsWithContent(backups[2], []byte("baaaaar!"), t)
+	existsWithContent(backups[3], []byte("baaaaaz!"), t)
+
+	// after a long outage every backup is past the cutoff, but the newest two
+	// are kept.
+	for i := 0; i < 5; i++ {
+		newFakeTime()
+	}
+	l, err = New(opts...)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	<-time.After(10 * time.Millisecond)
+	existsWithContent(backups[2], []byte("baaaaar!"), t)
+	existsWithContent(backups[3], []byte("baaaaaz!"), t)
+	fileCount(dir, 3, t)
+}
+
 func TestOldLogFiles(t *testing.T) {
 	currentTime = fakeTime
 
@@ -502,6 +603,101 @@ func TestTimeFromName(t *testing.T) {
 	}
 }
 
+func TestTimeAndSeqFromName(t *testing.T) {
+	l := &loggerOption{filename: "/var/log/myfoo/foo.log"}
+	prefix, ext := l.prefixAndExt()
+
+	tests := []struct {
+		filename string
+		want     time.Time
+		wantSeq  int
+		wantErr  bool
+	}{
+		{"foo-2014-05-04T14-44-33.555.log", time.Date(2014, 5, 4, 14, 44, 33, 555000000, time.UTC), 0, false},
+		{"foo-2014-05-04T14-44-33.555-2.log", time.Date(2014, 5, 4, 14, 44, 33, 555000000, time.UTC), 2, false},
+		{"foo-2014-05-04T14-44-33.555-.log", time.Time{}, 0, true},
+		{"foo-2014-05-04T14-44-33.555-0.log", time.Time{}, 0, true},
+		{"foo-2014-05-04T14-44-33.555-+2.log", time.Time{}, 0, true},
+		{"foo-2014-05-04T14-44-33.5552.log", time.Time{}, 0, true},
+	}
+
+	for _, test := range tests {
+		got, seq, err := l.timeAndSeqFromName(test.filename, prefix, ext)
+		require.Equal(t, test.want, got, test.filename)
+		require.Equal(t, test.wantSeq, seq, test.filename)
+		require.Equal(t, test.wantErr, err != nil, test.filename)
+	}
+}
+
+func TestRotateCollision(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestRotateCollision", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBackups(2),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	newFakeTime()
+
+	// three rotations within the same millisecond.
+	for _, s := range []string{"boo!", "foo!", "bar!"} {
+		_, err = l.Write([]byte(s))
+		require.NoError(t, err)
+		err = l.Rotate()
+		require.NoError(t, err)
+	}
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+
+	// the first backup is the oldest, so it's the one removed.
+	backup := backupFile(dir)
+	ext := filepath.Ext(backup)
+	notExist(backup, t)
+	existsWithContent(strings.TrimSuffix(backup, ext)+"-1"+ext, []byte("foo!"), t)
+	existsWithContent(strings.TrimSuffix(backup, ext)+"-2"+ext, []byte("bar!"), t)
+	fileCount(dir, 3, t)
+}
+
+func TestRotateCollisionCompressed(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestRotateCollisionCompressed", t)
+	defer os.RemoveAll(dir) // nolint
+
+	// a backup from the same millisecond that has already been compressed.
+	backup := backupFile(dir)
+	data := []byte("data")
+	err := ioutil.WriteFile(backup+compressSuffix, data, 0600)
+	require.NoError(t, err)
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+	err = l.Rotate()
+	require.NoError(t, err)
+
+	// the new backup doesn't take the name, so compressing it would not
+	// overwrite the older one.
+	ext := filepath.Ext(backup)
+	notExist(backup, t)
+	existsWithContent(backup+compressSuffix, data, t)
+	existsWithContent(strings.TrimSuffix(backup, ext)+"-1"+ext, b, t)
+	fileCount(dir, 3, t)
+}
+
 func TestLocalTime(t *testing.T) {
 	currentTime = fakeTime
 
@@ -794,6 +990,262 @@ func TestReWrite(t *testing.T) {
 	fileCount(dir, 1, t)
 }
 
+func TestRotateOnOpen(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestRotateOnOpen", t)
+	defer os.RemoveAll(dir) // nolint
+
+	// an older backup from a previous run.
+	data := []byte("data")
+	backup := backupFile(dir)
+	err := ioutil.WriteFile(backup, data, 0600)
+	require.NoError(t, err)
+
+	newFakeTime()
+
+	filename := logFile(dir)
+	start := []byte("boo!")
+	err = ioutil.WriteFile(filename, start, 0600)
+	require.NoError(t, err)
+
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBackups(1),
+		WithRotateOnOpen(),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	existsWithContent(filename, []byte{}, t)
+	existsWithContent(backupFile(dir), start, t)
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+
+	notExist(backup, t)
+	fileCount(dir, 2, t)
+}
+
+func TestRecords(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestRecords", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBytes(10),
+		WithRecords(),
+	)
+	require.NoError(t, err)
+
+	// nothing is written until the record is complete.
+	b := []byte("boo")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+	existsWithContent(filename, []byte{}, t)
+
+	b2 := []byte("!\nfoo")
+	n, err = l.Write(b2)
+	require.NoError(t, err)
+	require.Equal(t, len(b2), n)
+	existsWithContent(filename, []byte("boo!\n"), t)
+
+	newFakeTime()
+
+	// the whole record moves to the new file.
+	b3 := []byte("oooo!\n")
+	n, err = l.Write(b3)
+	require.NoError(t, err)
+	require.Equal(t, len(b3), n)
+	existsWithContent(backupFile(dir), []byte("boo!\n"), t)
+	existsWithContent(filename, []byte("foooooo!\n"), t)
+
+	newFakeTime()
+
+	// an incomplete record is written out on close.
+	b4 := []byte("bar")
+	n, err = l.Write(b4)
+	require.NoError(t, err)
+	require.Equal(t, len(b4), n)
+
+	err = l.Close()
+	require.NoError(t, err)
+	existsWithContent(backupFile(dir), []byte("foooooo!\n"), t)
+	existsWithContent(filename, b4, t)
+	fileCount(dir, 3, t)
+}
+
+func TestRecordsUnterminated(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestRecordsUnterminated", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBytes(10),
+		WithRecords(),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("abcdef")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+	existsWithContent(filename, []byte{}, t)
+
+	// the record never ends and can't fit in a file, so it is handed to the
+	// oversize policy, which rejects it, rather than held on to.
+	b2 := []byte("ghijkl")
+	n, err = l.Write(b2)
+	require.Error(t, err)
+	require.Equal(t, 0, n)
+	existsWithContent(filename, []byte{}, t)
+
+	b3 := []byte("boo!\n")
+	n, err = l.Write(b3)
+	require.NoError(t, err)
+	require.Equal(t, len(b3), n)
+	existsWithContent(filename, b3, t)
+}
+
+func TestRecordsUnterminatedSplit(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestRecordsUnterminatedSplit", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBytes(10),
+		WithRecords(),
+		WithOversize(OversizeSplit),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	_, err = l.Write([]byte("abcdef"))
+	require.NoError(t, err)
+
+	newFakeTime()
+	b := []byte("ghijkl")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+	existsWithContent(backupFile(dir), []byte("abcdefghij"), t)
+	existsWithContent(filename, []byte("kl"), t)
+}
+
+func TestRecordDelimiter(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestRecordDelimiter", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithRecordDelimiter(0),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!\nfoo!\x00bar")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+	existsWithContent(filename, []byte("boo!\nfoo!\x00"), t)
+}
+
+func TestRecordsMaxLines(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestRecordsMaxLines", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithRecordDelimiter(0),
+		WithMaxLines(2),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	newFakeTime()
+
+	b := []byte("x\n\x00")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+
+	// the record doesn't fit in what is left of the file, so the file is
+	// rotated before it rather than splitting it.
+	b2 := []byte("a\nb\nc\n\x00")
+	n, err = l.Write(b2)
+	require.NoError(t, err)
+	require.Equal(t, len(b2), n)
+	existsWithContent(backupFile(dir), b, t)
+	existsWithContent(filename, b2, t)
+	fileCount(dir, 2, t)
+}
+
+func TestMaxLines(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestMaxLines", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxLines(2),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	newFakeTime()
+
+	// the third line goes into a new file.
+	b := []byte("boo!\nfoo!\nbar!\n")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+	existsWithContent(backupFile(dir), []byte("boo!\nfoo!\n"), t)
+	existsWithContent(filename, []byte("bar!\n"), t)
+	fileCount(dir, 2, t)
+}
+
+func TestMaxLinesOnResume(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestMaxLinesOnResume", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	data := []byte("boo!\nfoo!\n")
+	err := ioutil.WriteFile(filename, data, 0600)
+	require.NoError(t, err)
+
+	l, err := New(
+		WithFileName(filename),
+		WithMaxLines(3),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	newFakeTime()
+
+	// the existing file only has room for one more line.
+	b := []byte("bar!\nbaz!\n")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+	existsWithContent(backupFile(dir), []byte("boo!\nfoo!\nbar!\n"), t)
+	existsWithContent(filename, []byte("baz!\n"), t)
+	fileCount(dir, 2, t)
+}
+
 // makeTempDir creates a file with a semi-unique name in the OS temp directory.
 // It should be based on the name of the test, to keep parallel tests from
 // colliding, and must be cleaned up after the test is finished.
@@ -0,0 +1,86 @@
+package lumberjack
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// shiftBackups renumbers the numbered backups of the named log file one up,
+// from the oldest to the newest, and then moves the log file itself to backup
+// number 1.
+func (l *loggerOption) shiftBackups(name string) error {
+	l.millMu.Lock()
+	defer l.millMu.Unlock()
+
+	base := l.backupBase(name)
+	files, err := l.backupsIn(base)
+	if err != nil {
+		return err
+	}
+	sort.Sort(byNumber(files))
+
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+		if f.interrupted {
+			// the mill removes it, and renaming it would make it look
+			// like a whole backup.
+			continue
+		}
+		suffix := l.compressedSuffix(f.Name())
+		newpath := numberedName(base, f.number+1) + suffix
+		if err := os.Rename(f.path(), newpath); err != nil {
+			return err
+		}
+		l.followRename(f.path(), newpath)
+	}
+
+	return moveFile(l.activePath(name), numberedName(base, 1)+l.streamSuffix())
+}
+
+// numberedName returns the name of the given numbered backup of the named log
+// file.
+func numberedName(name string, number int) string {
+	return fmt.Sprintf("%s.%d", name, number)
+}
+
+// numberFromName extracts the backup number from the filename of a numbered
+// backup of the log file with the given base name, which may be compressed.
+func (l *loggerOption) numberFromName(filename, base string) (int, error) {
+	filename = l.trimCompressed(filename)
+	if !strings.HasPrefix(filename, base+".") {
+		return 0, errors.New("mismatched prefix")
+	}
+	return parseNumber(filename[len(base)+1:])
+}
+
+// parseNumber parses a positive decimal number without a sign.
+func parseNumber(num string) (int, error) {
+	if num == "" || num[0] < '0' || num[0] > '9' {
+		return 0, errors.New("missing number")
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid number %q", num)
+	}
+	return n, nil
+}
+
+// byNumber sorts numbered backups from newest to oldest, which is by ascending
+// number.
+type byNumber []logInfo
+
+func (b byNumber) Less(i, j int) bool {
+	return b[i].number < b[j].number
+}
+
+func (b byNumber) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
+
+func (b byNumber) Len() int {
+	return len(b)
+}
@@ -0,0 +1,251 @@
+package lumberjack
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNumberFromName(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     int
+		wantErr  bool
+	}{
+		{"foo.log.1", 1, false},
+		{"foo.log.12.gz", 12, false},
+		{"foo.log", 0, true},
+		{"foo.log.", 0, true},
+		{"foo.log.0", 0, true},
+		{"foo.log.+1", 0, true},
+		{"foo.log.1.bak", 0, true},
+		{"bar.log.1", 0, true},
+	}
+
+	l := &loggerOption{}
+	for _, test := range tests {
+		got, err := l.numberFromName(test.filename, "foo.log")
+		require.Equal(t, test.want, got, test.filename)
+		require.Equal(t, test.wantErr, err != nil, test.filename)
+	}
+}
+
+func TestNumberedBackups(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestNumberedBackups", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBytes(10),
+		WithMaxBackups(2),
+		WithNumberedBackups(),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+
+	b2 := []byte("foooooo!")
+	n, err = l.Write(b2)
+	require.NoError(t, err)
+	require.Equal(t, len(b2), n)
+	existsWithContent(filename+".1", b, t)
+	existsWithContent(filename, b2, t)
+
+	b3 := []byte("baaaaar!")
+	n, err = l.Write(b3)
+	require.NoError(t, err)
+	require.Equal(t, len(b3), n)
+	existsWithContent(filename+".2", b, t)
+	existsWithContent(filename+".1", b2, t)
+	existsWithContent(filename, b3, t)
+
+	b4 := []byte("baaaaaz!")
+	n, err = l.Write(b4)
+	require.NoError(t, err)
+	require.Equal(t, len(b4), n)
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+
+	// the oldest backup was shifted to number 3 and then removed.
+	notExist(filename+".3", t)
+	existsWithContent(filename+".2", b2, t)
+	existsWithContent(filename+".1", b3, t)
+	existsWithContent(filename, b4, t)
+	fileCount(dir, 3, t)
+}
+
+func TestNumberedBackupsWithFormat(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestNumberedBackupsWithFormat", t)
+	defer os.RemoveAll(dir) // nolint
+
+	// renumbering couldn't find the backups named by the template, and would
+	// overwrite the newest one on every rotation.
+	_, err := New(
+		WithFileName(logFile(dir)),
+		WithNumberedBackups(),
+		WithBackupFormat("{prefix}.{time:20060102-150405}.{seq}{ext}"),
+	)
+	require.Error(t, err)
+	fileCount(dir, 0, t)
+}
+
+func TestNumberedBackupsCompressed(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestNumberedBackupsCompressed", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithNumberedBackups(),
+		WithCompress(),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+
+	err = l.Rotate()
+	require.NoError(t, err)
+
+	// we need to wait a little bit since the files get compressed on a different
+	// goroutine.
+	<-time.After(300 * time.Millisecond)
+
+	err = l.Rotate()
+	require.NoError(t, err)
+
+	<-time.After(300 * time.Millisecond)
+
+	// the compressed backup keeps its suffix when it is renumbered.
+	bc := new(bytes.Buffer)
+	gz := gzip.NewWriter(bc)
+	_, err = gz.Write(b)
+	require.NoError(t, err)
+	err = gz.Close()
+	require.NoError(t, err)
+
+	existsWithContent(filename+".2"+compressSuffix, bc.Bytes(), t)
+	notExist(filename+".2", t)
+	notExist(filename+".1", t)
+	exists(filename+".1"+compressSuffix, t)
+	fileCount(dir, 3, t)
+}
+
+func TestNumberedBackupsRotateWhileCompressing(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestNumberedBackupsRotateWhileCompressing", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	for i := 1; i <= 10; i++ {
+		b := []byte(fmt.Sprintf("backup %d", i))
+		require.NoError(t, ioutil.WriteFile(numberedName(filename, i), b, 0600))
+	}
+
+	var active, peak int
+	c := slowCompressor{mu: &sync.Mutex{}, active: &active, peak: &peak}
+	l, err := New(
+		WithFileName(filename),
+		WithNumberedBackups(),
+		WithCompressor(c),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+
+	// the backups take a while to compress one after another, and rotating
+	// doesn't wait for them.
+	<-time.After(10 * time.Millisecond)
+	start := time.Now()
+	err = l.Rotate()
+	require.NoError(t, err)
+	require.True(t, time.Since(start) < 100*time.Millisecond)
+
+	<-time.After(800 * time.Millisecond)
+
+	// every backup ends up compressed under its new number.
+	existsWithContent(numberedName(filename, 1)+".nop", b, t)
+	for i := 1; i <= 10; i++ {
+		name := numberedName(filename, i+1)
+		existsWithContent(name+".nop", []byte(fmt.Sprintf("backup %d", i)), t)
+		notExist(name, t)
+	}
+	fileCount(dir, 12, t)
+}
+
+// gateCompressor "compresses" by copying once gate is closed, counting the
+// files it compresses.
+type gateCompressor struct {
+	nopCompressor
+	gate  chan struct{}
+	count *int32
+}
+
+func (c gateCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	atomic.AddInt32(c.count, 1)
+	<-c.gate
+	return nopWriteCloser{w}, nil
+}
+
+func TestNumberedBackupsRenumberedWhileCompressing(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestNumberedBackupsRenumberedWhileCompressing", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	require.NoError(t, ioutil.WriteFile(numberedName(filename, 1), []byte("one"), 0600))
+
+	var count int32
+	c := gateCompressor{gate: make(chan struct{}), count: &count}
+	l, err := New(
+		WithFileName(filename),
+		WithNumberedBackups(),
+		WithCompressor(c),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	// the backup is renumbered twice while it is being compressed.
+	<-time.After(10 * time.Millisecond)
+	for _, b := range []string{"two", "three"} {
+		_, err = l.Write([]byte(b))
+		require.NoError(t, err)
+		require.NoError(t, l.Rotate())
+	}
+	close(c.gate)
+
+	<-time.After(300 * time.Millisecond)
+
+	// the compressed backup follows it to its new number rather than being
+	// thrown away and compressed again.
+	existsWithContent(numberedName(filename, 1)+".nop", []byte("three"), t)
+	existsWithContent(numberedName(filename, 2)+".nop", []byte("two"), t)
+	existsWithContent(numberedName(filename, 3)+".nop", []byte("one"), t)
+	fileCount(dir, 4, t)
+	require.Equal(t, int32(3), atomic.LoadInt32(&count))
+}
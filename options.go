@@ -1,6 +1,11 @@
 package lumberjack
 
-import "context"
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"time"
+)
 
 // LoggerOption ...
 type LoggerOption interface {
@@ -23,8 +28,9 @@ func newFuncLoggerOption(f func(*loggerOption)) *funcLoggerOption {
 
 func defaultOptions() *loggerOption {
 	return &loggerOption{
-		bufSize: 1,
-		millCh:  make(chan bool, 1),
+		bufSize:   1,
+		delimiter: '\n',
+		millCh:    make(chan bool, 1),
 	}
 }
 
@@ -38,12 +44,55 @@ func New(opts ...LoggerOption) (Writer, error) {
 		opt.apply(fo)
 	}
 
+	if fo.compressLevel != nil {
+		c, err := withLevel(fo.compressor, *fo.compressLevel)
+		if err != nil {
+			return nil, err
+		}
+		fo.compressor = c
+	}
+	if fo.compressor == nil {
+		fo.compressor = Gzip(gzip.DefaultCompression)
+	}
+	if suffix := fo.compressor.Suffix(); !validSuffix(suffix) {
+		return nil, fmt.Errorf("compressor suffix %q must start with a dot and can't be %q", suffix, compressTmpSuffix)
+	}
+	if fo.stream && fo.compressor.Suffix() != compressSuffix {
+		return nil, fmt.Errorf("stream compression needs gzip, whose members can be concatenated, not the %q compressor", fo.compressor.Suffix())
+	}
+
+	if fo.filePattern != "" {
+		p, err := parsePattern(fo.filePattern)
+		if err != nil {
+			return nil, err
+		}
+		fo.pattern = p
+	}
+
+	if fo.backupFormat != "" {
+		if fo.numbered {
+			// numbered backups are named `name.ext.N`, and renumbering
+			// them couldn't find backups named by a template.
+			return nil, fmt.Errorf("backup format %q can't be used with numbered backups", fo.backupFormat)
+		}
+		t, err := parseTemplate(fo.backupFormat)
+		if err != nil {
+			return nil, err
+		}
+		fo.template = t
+	}
+
 	if err := fo.openExistingOrNew(); err != nil {
 		return nil, err
 	}
 
 	go fo.millRun(ctx)
 
+	if fo.schedule != nil {
+		fo.nextRotation = fo.schedule.Next(fo.timeIn(currentTime()))
+		go fo.rotateRun(ctx)
+	}
+
 	return fo, nil
 }
 
@@ -54,6 +103,34 @@ func WithFileName(name string) LoggerOption {
 	})
 }
 
+// WithArchiveDir ...
+func WithArchiveDir(dir string) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.archiveDir = dir
+	})
+}
+
+// WithArchivePartitions ...
+func WithArchivePartitions(layout string) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.partition = layout
+	})
+}
+
+// WithFilePattern ...
+func WithFilePattern(pattern string) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.filePattern = pattern
+	})
+}
+
+// WithSymlink ...
+func WithSymlink(path string) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.symlink = path
+	})
+}
+
 // WithMaxBytes ...
 func WithMaxBytes(bytes int64) LoggerOption {
 	return newFuncLoggerOption(func(l *loggerOption) {
@@ -61,6 +138,20 @@ func WithMaxBytes(bytes int64) LoggerOption {
 	})
 }
 
+// WithOversize ...
+func WithOversize(oversize Oversize) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.oversize = oversize
+	})
+}
+
+// WithMaxLines ...
+func WithMaxLines(lines int64) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.maxLines = lines
+	})
+}
+
 // WithMaxBackups ...
 func WithMaxBackups(size int) LoggerOption {
 	return newFuncLoggerOption(func(l *loggerOption) {
@@ -68,6 +159,62 @@ func WithMaxBackups(size int) LoggerOption {
 	})
 }
 
+// WithMaxAge ...
+func WithMaxAge(age time.Duration) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.maxAge = age
+	})
+}
+
+// WithMaxCalendarDays ...
+func WithMaxCalendarDays(days int) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.maxCalendarDays = days
+	})
+}
+
+// WithMaxCalendarMonths ...
+func WithMaxCalendarMonths(months int) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.maxCalendarMonths = months
+	})
+}
+
+// WithRetentionLocation ...
+func WithRetentionLocation(loc *time.Location) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.retentionLocation = loc
+	})
+}
+
+// WithAgeByModTime ...
+func WithAgeByModTime() LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.ageByModTime = true
+	})
+}
+
+// WithLegacyBackups ...
+func WithLegacyBackups(glob string) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.legacyBackups = glob
+	})
+}
+
+// WithMinBackups ...
+func WithMinBackups(n int) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.minBackups = n
+	})
+}
+
+// WithMaxTotalBytes ...
+func WithMaxTotalBytes(bytes int64) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.maxTotalBytes = bytes
+	})
+}
+
 // WithMaxDays ...
 func WithMaxDays(days int) LoggerOption {
 	return newFuncLoggerOption(func(l *loggerOption) {
@@ -75,6 +222,43 @@ func WithMaxDays(days int) LoggerOption {
 	})
 }
 
+// WithDryRun ...
+func WithDryRun(report func(RetentionPlan)) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.dryRun = true
+		l.planHandler = report
+	})
+}
+
+// WithDiskWatermarks ...
+func WithDiskWatermarks(low, critical uint64) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.lowWatermark = low
+		l.criticalWatermark = critical
+	})
+}
+
+// WithDegraded ...
+func WithDegraded(degraded Degraded) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.degraded = degraded
+	})
+}
+
+// WithSampleRate ...
+func WithSampleRate(rate int) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.sampleRate = rate
+	})
+}
+
+// WithErrorHandler ...
+func WithErrorHandler(handler func(error)) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.errorHandler = handler
+	})
+}
+
 // WithCompress ...
 func WithCompress() LoggerOption {
 	return newFuncLoggerOption(func(l *loggerOption) {
@@ -82,6 +266,57 @@ func WithCompress() LoggerOption {
 	})
 }
 
+// WithCompressor ...
+func WithCompressor(c Compressor) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.compress = true
+		l.compressor = c
+	})
+}
+
+// WithCompressionLevel ...
+func WithCompressionLevel(level int) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.compress = true
+		l.compressLevel = &level
+	})
+}
+
+// WithCompressWorkers ...
+func WithCompressWorkers(n int) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.compressWorkers = n
+	})
+}
+
+// WithDelayCompress ...
+func WithDelayCompress(n int) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.delayCompress = n
+	})
+}
+
+// WithStreamCompression ...
+func WithStreamCompression() LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.stream = true
+	})
+}
+
+// WithNumberedBackups ...
+func WithNumberedBackups() LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.numbered = true
+	})
+}
+
+// WithBackupFormat ...
+func WithBackupFormat(format string) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.backupFormat = format
+	})
+}
+
 // WithLocalTime ...
 func WithLocalTime() LoggerOption {
 	return newFuncLoggerOption(func(l *loggerOption) {
@@ -102,3 +337,46 @@ func WithReWrite() LoggerOption {
 		l.rewrite = true
 	})
 }
+
+// WithRecords ...
+func WithRecords() LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.records = true
+	})
+}
+
+// WithRecordDelimiter ...
+func WithRecordDelimiter(delim byte) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.records = true
+		l.delimiter = delim
+	})
+}
+
+// WithRotateOnOpen ...
+func WithRotateOnOpen() LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.rotateOnOpen = true
+	})
+}
+
+// WithRotateEvery ...
+func WithRotateEvery(every Interval) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.schedule = every
+	})
+}
+
+// WithSchedule ...
+func WithSchedule(schedule Schedule) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.schedule = schedule
+	})
+}
+
+// WithRotationPolicy ...
+func WithRotationPolicy(policy RotationPolicy) LoggerOption {
+	return newFuncLoggerOption(func(l *loggerOption) {
+		l.policy = policy
+	})
+}
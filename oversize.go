@@ -0,0 +1,85 @@
+package lumberjack
+
+import "fmt"
+
+// Oversize determines what happens to a single write larger than MaxSize.
+type Oversize int
+
+const (
+	// OversizeReject rejects the write with an error.  This is the default.
+	OversizeReject Oversize = iota
+	// OversizeSplit splits the write across as many files as needed, each
+	// filled up to MaxSize.
+	OversizeSplit
+	// OversizeTruncate cuts the write down to MaxSize, ending it with a
+	// marker that shows it was truncated.
+	OversizeTruncate
+	// OversizeAlone writes the whole write into a file of its own, which then
+	// exceeds MaxSize.
+	OversizeAlone
+)
+
+// truncatedMarker ends a write cut down by OversizeTruncate.
+const truncatedMarker = "...[truncated]\n"
+
+// writeOversize writes p, which is larger than MaxSize, according to the
+// Oversize policy.  The whole of p is reported as written unless an error
+// occurs, even if it was truncated.
+func (l *loggerOption) writeOversize(p []byte) (n int, err error) {
+	switch l.oversize {
+	case OversizeSplit:
+		return l.writeSplit(p)
+	case OversizeTruncate:
+		if _, err := l.write(truncate(p, l.maxBytes)); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	case OversizeAlone:
+		if l.size > 0 {
+			if err := l.rotate(); err != nil {
+				return 0, err
+			}
+		}
+		// the next write rotates since the file is already over MaxSize.
+		return l.writeFile(p)
+	default:
+		return 0, fmt.Errorf(
+			"write length %d exceeds maximum file size %d", len(p), l.maxBytes,
+		)
+	}
+}
+
+// writeSplit writes p in chunks that each fill the current log file up to
+// MaxSize, rotating in between.
+func (l *loggerOption) writeSplit(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		room := l.maxBytes - l.size
+		if room <= 0 {
+			// write rotates before taking a full file's worth.
+			room = l.maxBytes
+		}
+		if room > int64(len(p)) {
+			room = int64(len(p))
+		}
+
+		m, err := l.write(p[:room])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[room:]
+	}
+	return n, nil
+}
+
+// truncate returns a copy of p cut down to max bytes, ending with the truncated
+// marker if there is room for it.
+func truncate(p []byte, max int64) []byte {
+	keep := max - int64(len(truncatedMarker))
+	if keep < 0 {
+		return append([]byte(nil), p[:max]...)
+	}
+	t := make([]byte, 0, max)
+	t = append(t, p[:keep]...)
+	return append(t, truncatedMarker...)
+}
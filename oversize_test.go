@@ -0,0 +1,101 @@
+package lumberjack
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOversizeSplit(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestOversizeSplit", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBytes(10),
+		WithOversize(OversizeSplit),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+
+	newFakeTime()
+
+	// the first file is filled up, and the rest goes into the next one.
+	b2 := []byte("0123456789abcd")
+	n, err = l.Write(b2)
+	require.NoError(t, err)
+	require.Equal(t, len(b2), n)
+	existsWithContent(backupFile(dir), []byte("boo!012345"), t)
+	existsWithContent(filename, []byte("6789abcd"), t)
+	fileCount(dir, 2, t)
+}
+
+func TestOversizeTruncate(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestOversizeTruncate", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBytes(20),
+		WithOversize(OversizeTruncate),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+	existsWithContent(filename, []byte("01234"+truncatedMarker), t)
+	fileCount(dir, 1, t)
+}
+
+func TestOversizeAlone(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestOversizeAlone", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBytes(10),
+		WithOversize(OversizeAlone),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+
+	newFakeTime()
+
+	b2 := []byte("0123456789abcd")
+	n, err = l.Write(b2)
+	require.NoError(t, err)
+	require.Equal(t, len(b2), n)
+	existsWithContent(backupFile(dir), b, t)
+	existsWithContent(filename, b2, t)
+
+	newFakeTime()
+
+	// the oversized file is rotated on the next write.
+	b3 := []byte("foo!")
+	n, err = l.Write(b3)
+	require.NoError(t, err)
+	require.Equal(t, len(b3), n)
+	existsWithContent(backupFile(dir), b2, t)
+	existsWithContent(filename, b3, t)
+	fileCount(dir, 3, t)
+}
@@ -0,0 +1,211 @@
+package lumberjack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// patternVerbs maps the strftime-style verbs accepted in a file pattern to the
+// equivalent time.Time layout and an expression matching their value.
+var patternVerbs = map[byte]struct {
+	layout, expr string
+}{
+	'Y': {"2006", `\d{4}`},
+	'y': {"06", `\d{2}`},
+	'm': {"01", `\d{2}`},
+	'd': {"02", `\d{2}`},
+	'j': {"002", `\d{3}`},
+	'H': {"15", `\d{2}`},
+	'M': {"04", `\d{2}`},
+	'S': {"05", `\d{2}`},
+}
+
+// filePattern computes the name of the log file from the current time, from a
+// pattern such as `/var/log/app/%Y/%m/%d/app.log`.  The verbs are %Y, %y, %m,
+// %d, %j, %H, %M and %S as in strftime, and %% for a literal percent sign.
+// A pattern needs a year, and a full date (%m and %d, or %j) if it uses %d or
+// a time of day, so that the time of every log file is known for retention.
+type filePattern struct {
+	// parts alternates between literal text and verbs, starting with text.
+	parts []string
+}
+
+// parsePattern parses a file pattern.
+func parsePattern(pattern string) (*filePattern, error) {
+	pattern = filepath.Clean(pattern)
+	p := &filePattern{}
+	var lit strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			lit.WriteByte(pattern[i])
+			continue
+		}
+		if i+1 == len(pattern) {
+			return nil, fmt.Errorf("file pattern %q ends with %%", pattern)
+		}
+		i++
+		if pattern[i] == '%' {
+			lit.WriteByte('%')
+			continue
+		}
+		if _, ok := patternVerbs[pattern[i]]; !ok {
+			return nil, fmt.Errorf("file pattern %q has unknown verb %%%c", pattern, pattern[i])
+		}
+		p.parts = append(p.parts, lit.String(), pattern[i:i+1])
+		lit.Reset()
+	}
+	p.parts = append(p.parts, lit.String())
+
+	if len(p.parts) == 1 {
+		return nil, fmt.Errorf("file pattern %q has no time verbs", pattern)
+	}
+
+	verbs := make(map[byte]bool)
+	for i := 1; i < len(p.parts); i += 2 {
+		verbs[p.parts[i][0]] = true
+	}
+	if !verbs['Y'] && !verbs['y'] {
+		return nil, fmt.Errorf("file pattern %q has no year", pattern)
+	}
+	if (verbs['d'] || verbs['H'] || verbs['M'] || verbs['S']) && !(verbs['m'] && verbs['d']) && !verbs['j'] {
+		return nil, fmt.Errorf("file pattern %q has no full date", pattern)
+	}
+	return p, nil
+}
+
+// format returns the name of the log file at t.
+func (p *filePattern) format(t time.Time) string {
+	var b strings.Builder
+	for i, part := range p.parts {
+		if i%2 == 0 {
+			b.WriteString(part)
+		} else {
+			b.WriteString(t.Format(patternVerbs[part[0]].layout))
+		}
+	}
+	return filepath.Clean(b.String())
+}
+
+// root returns the deepest directory that holds every log file the pattern can
+// generate.
+func (p *filePattern) root() string {
+	return filepath.Dir(p.parts[0] + "x")
+}
+
+// depth returns how many directories below the root the log files the pattern
+// can generate are.
+func (p *filePattern) depth() int {
+	var b strings.Builder
+	for i, part := range p.parts {
+		if i%2 == 0 {
+			b.WriteString(part)
+		} else {
+			// no verb expands to a path separator.
+			b.WriteString("0")
+		}
+	}
+	rel, err := filepath.Rel(p.root(), b.String())
+	if err != nil {
+		return -1
+	}
+	return strings.Count(filepath.ToSlash(rel), "/")
+}
+
+// regexp returns an expression matching the names the pattern generates,
+// capturing the value of each verb.
+func (p *filePattern) regexp() *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i, part := range p.parts {
+		if i%2 == 0 {
+			b.WriteString(regexp.QuoteMeta(part))
+		} else {
+			b.WriteString("(" + patternVerbs[part[0]].expr + ")")
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// parse returns the time encoded in a name matched by re, in loc.
+func (p *filePattern) parse(re *regexp.Regexp, name string, loc *time.Location) (time.Time, error) {
+	m := re.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, fmt.Errorf("%q doesn't match the file pattern", name)
+	}
+
+	var layout []string
+	for i := 1; i < len(p.parts); i += 2 {
+		layout = append(layout, patternVerbs[p.parts[i][0]].layout)
+	}
+	return time.ParseInLocation(strings.Join(layout, " "), strings.Join(m[1:], " "), loc)
+}
+
+// patternLogFiles returns the log files generated by the file pattern other
+// than the current one, along with the backups of all of them, by walking the
+// directory tree under the pattern's root.
+func (l *loggerOption) patternLogFiles() ([]logInfo, error) {
+	dirs, err := walkDirs(l.pattern.root(), l.pattern.depth())
+	if err != nil {
+		return nil, fmt.Errorf("can't read log file directory: %s", err)
+	}
+
+	archived := l.archiveDir != "" || l.partitioned()
+	var archive map[string][]os.FileInfo
+	if archived {
+		// the backups of every log file are in the same place, or under it.
+		base := l.backupBase(l.pattern.format(l.timeIn(currentTime())))
+		if archive, err = l.archivedFiles(base); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("can't read archive directory: %s", err)
+		}
+	}
+
+	re := l.pattern.regexp()
+	current, _ := l.current.Load().(string)
+	logFiles := []logInfo{}
+	// files with the same name in different directories share the backups
+	// in the archive.
+	seen := make(map[string]bool)
+	for dir, files := range dirs {
+		for _, f := range files {
+			name := filepath.Join(dir, f.Name())
+			compressed, interrupted := l.interruptedName(name)
+			t, err := l.pattern.parse(re, l.trimCompressed(compressed), l.location())
+			if err != nil {
+				continue
+			}
+			if name != current {
+				logFiles = append(logFiles, logInfo{timestamp: t, dir: dir, interrupted: interrupted, FileInfo: f})
+			}
+			if interrupted || l.isCompressed(name) {
+				continue
+			}
+			if !archived {
+				logFiles = append(logFiles, l.backupsOf(name, files)...)
+			} else if base := l.backupBase(name); !seen[base] {
+				seen[base] = true
+				logFiles = append(logFiles, l.backupsAmong(base, archive)...)
+			}
+		}
+	}
+	return logFiles, nil
+}
+
+// removeEmptyDirs removes dir and its parents, up to but not including root,
+// for as long as they are empty.
+func removeEmptyDirs(dir, root string) {
+	for {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return
+		}
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,122 @@
+package lumberjack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{"/var/log/app/%Y/%m/%d/app.log", false},
+		{"app-%Y%m%d%H%M%S.log", false},
+		{"/var/log/100%%/%Y/%j/app.log", false},
+		{"/var/log/app/%Y-%m.log", false},
+		{"/var/log/app/%m/%d/app.log", true},
+		{"/var/log/app/%H.log", true},
+		{"/var/log/app/%Y/%d/app.log", true},
+		{"/var/log/app/%Y/%m/%H.log", true},
+		{"/var/log/app.log", true},
+		{"/var/log/%Q/app.log", true},
+		{"/var/log/app.log.%", true},
+	}
+
+	for _, test := range tests {
+		_, err := parsePattern(test.pattern)
+		require.Equal(t, test.wantErr, err != nil, test.pattern)
+	}
+}
+
+func TestPatternRoundTrip(t *testing.T) {
+	p, err := parsePattern("/var/log/100%%/%Y/%m/%d/app-%H.log")
+	require.NoError(t, err)
+	require.Equal(t, "/var/log/100%", p.root())
+	require.Equal(t, 3, p.depth())
+
+	ts := time.Date(2020, 10, 9, 14, 0, 0, 0, time.UTC)
+	name := p.format(ts)
+	require.Equal(t, "/var/log/100%/2020/10/09/app-14.log", name)
+
+	got, err := p.parse(p.regexp(), name, time.UTC)
+	require.NoError(t, err)
+	require.Equal(t, ts, got)
+
+	_, err = p.parse(p.regexp(), "/var/log/100%/2020/10/09/app.log", time.UTC)
+	require.Error(t, err)
+}
+
+func TestPatternDepth(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    int
+	}{
+		{"/var/log/app-%Y%m%d.log", 0},
+		{"app-%Y%m%d.log", 0},
+		{"/var/log/app/%Y/%m/%d/app.log", 3},
+		{"logs/%Y-%m/app-%d.log", 1},
+	}
+
+	for _, test := range tests {
+		p, err := parsePattern(test.pattern)
+		require.NoError(t, err, test.pattern)
+		require.Equal(t, test.want, p.depth(), test.pattern)
+	}
+}
+
+func TestFilePattern(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestFilePattern", t)
+	defer os.RemoveAll(dir) // nolint
+
+	dated := func() string {
+		return filepath.Join(dir, fakeTime().UTC().Format("20060102"), "foobar.log")
+	}
+
+	l, err := New(
+		WithFilePattern(filepath.Join(dir, "%Y%m%d", "foobar.log")),
+		WithMaxBackups(1),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+	first := dated()
+	existsWithContent(first, b, t)
+
+	newFakeTime()
+
+	// the next day's write goes to a new file.
+	b2 := []byte("foo!")
+	n, err = l.Write(b2)
+	require.NoError(t, err)
+	require.Equal(t, len(b2), n)
+	second := dated()
+	existsWithContent(second, b2, t)
+	existsWithContent(first, b, t)
+
+	newFakeTime()
+
+	b3 := []byte("bar!")
+	n, err = l.Write(b3)
+	require.NoError(t, err)
+	require.Equal(t, len(b3), n)
+	existsWithContent(dated(), b3, t)
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+
+	// the oldest file is past MaxBackups, and its empty directory goes too.
+	notExist(filepath.Dir(first), t)
+	existsWithContent(second, b2, t)
+	fileCount(dir, 2, t)
+}
@@ -0,0 +1,109 @@
+package lumberjack
+
+import "time"
+
+// State describes the current log file and the pending write, for a
+// RotationPolicy to decide whether to rotate before the write.
+type State struct {
+	// Size is the number of bytes in the current log file.
+	Size int64
+
+	// Lines is the number of newlines in the current log file.
+	Lines int64
+
+	// Opened is when the current log file was opened.
+	Opened time.Time
+
+	// LastWrite is when the current log file was last written, or the zero
+	// time if it hasn't been written since it was created.
+	LastWrite time.Time
+
+	// Now is the current time.
+	Now time.Time
+
+	// WriteLen is the number of bytes in the pending write.
+	WriteLen int64
+
+	// WriteLines is the number of newlines in the pending write.
+	WriteLines int64
+}
+
+// RotationPolicy decides whether the log file should be rotated before a
+// write.  It is consulted in addition to the size limit and the schedule, so
+// the file is rotated if any of them asks for it.
+//
+// Policies can be combined with And and Or, so that "rotate at 50MB or every
+// hour, but never more than once a minute" is written as:
+//
+//	And(Or(SizePolicy(50*MB), AgePolicy(time.Hour)), AgePolicy(time.Minute))
+type RotationPolicy interface {
+	ShouldRotate(s State) bool
+}
+
+// RotationPolicyFunc adapts an ordinary function to a RotationPolicy.
+type RotationPolicyFunc func(s State) bool
+
+// ShouldRotate implements RotationPolicy.
+func (f RotationPolicyFunc) ShouldRotate(s State) bool {
+	return f(s)
+}
+
+// SizePolicy rotates a non-empty log file if the pending write would make it
+// larger than max bytes.
+func SizePolicy(max int64) RotationPolicy {
+	return RotationPolicyFunc(func(s State) bool {
+		return s.Size > 0 && s.Size+s.WriteLen > max
+	})
+}
+
+// AgePolicy rotates the log file once it has been open for at least d.
+func AgePolicy(d time.Duration) RotationPolicy {
+	return RotationPolicyFunc(func(s State) bool {
+		return s.Now.Sub(s.Opened) >= d
+	})
+}
+
+// LinePolicy rotates a non-empty log file if the pending write would make it
+// hold more than max lines.
+func LinePolicy(max int64) RotationPolicy {
+	return RotationPolicyFunc(func(s State) bool {
+		return s.Lines > 0 && s.Lines+s.WriteLines > max
+	})
+}
+
+// And rotates the log file only if all of the policies ask for it.
+func And(policies ...RotationPolicy) RotationPolicy {
+	return RotationPolicyFunc(func(s State) bool {
+		for _, p := range policies {
+			if !p.ShouldRotate(s) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Or rotates the log file if any of the policies asks for it.
+func Or(policies ...RotationPolicy) RotationPolicy {
+	return RotationPolicyFunc(func(s State) bool {
+		for _, p := range policies {
+			if p.ShouldRotate(s) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// state returns the State of the current log file before writing p.
+func (l *loggerOption) state(p []byte) State {
+	return State{
+		Size:       l.size,
+		Lines:      l.lines,
+		Opened:     l.opened,
+		LastWrite:  l.lastWrite,
+		Now:        currentTime(),
+		WriteLen:   int64(len(p)),
+		WriteLines: countLines(p),
+	}
+}
@@ -0,0 +1,80 @@
+package lumberjack
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicies(t *testing.T) {
+	now := time.Date(2020, 10, 9, 14, 44, 33, 0, time.UTC)
+	s := State{
+		Size:       40,
+		Lines:      4,
+		Opened:     now.Add(-30 * time.Second),
+		Now:        now,
+		WriteLen:   20,
+		WriteLines: 2,
+	}
+
+	never := RotationPolicyFunc(func(State) bool { return false })
+	always := RotationPolicyFunc(func(State) bool { return true })
+
+	tests := []struct {
+		name   string
+		policy RotationPolicy
+		want   bool
+	}{
+		{"size over", SizePolicy(50), true},
+		{"size fits", SizePolicy(60), false},
+		{"age reached", AgePolicy(30 * time.Second), true},
+		{"age not reached", AgePolicy(time.Minute), false},
+		{"lines over", LinePolicy(5), true},
+		{"lines fit", LinePolicy(6), false},
+		{"and", And(always, never), false},
+		{"and all", And(always, always), true},
+		{"or", Or(never, always), true},
+		{"or none", Or(never, never), false},
+		{"size or hour, at most once a minute", And(Or(SizePolicy(50), AgePolicy(time.Hour)), AgePolicy(time.Minute)), false},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.want, test.policy.ShouldRotate(s), test.name)
+	}
+
+	// an empty file is never rotated for its size.
+	require.False(t, SizePolicy(10).ShouldRotate(State{WriteLen: 20}))
+}
+
+func TestRotationPolicy(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestRotationPolicy", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithRotationPolicy(LinePolicy(2)),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!\nfoo!\n")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+	existsWithContent(filename, b, t)
+	fileCount(dir, 1, t)
+
+	newFakeTime()
+
+	b2 := []byte("bar!\n")
+	n, err = l.Write(b2)
+	require.NoError(t, err)
+	require.Equal(t, len(b2), n)
+	existsWithContent(filename, b2, t)
+	existsWithContent(backupFile(dir), b, t)
+	fileCount(dir, 2, t)
+}
@@ -0,0 +1,198 @@
+package lumberjack
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RetentionReason is why a backup is compressed or removed.
+type RetentionReason int
+
+const (
+	// ReasonCount removes a backup beyond MaxBackups.
+	ReasonCount RetentionReason = iota
+	// ReasonAge removes a backup older than the age limits.
+	ReasonAge
+	// ReasonBudget removes a backup that doesn't fit in the total size budget.
+	ReasonBudget
+	// ReasonDiskSpace removes a backup to bring the free disk space back up
+	// to the low watermark.
+	ReasonDiskSpace
+	// ReasonCompress compresses a backup that is kept.
+	ReasonCompress
+	// ReasonInterrupted removes what an interrupted compression left behind,
+	// so that the backup is compressed again.
+	ReasonInterrupted
+)
+
+// String implements fmt.Stringer.
+func (r RetentionReason) String() string {
+	switch r {
+	case ReasonCount:
+		return "count"
+	case ReasonAge:
+		return "age"
+	case ReasonBudget:
+		return "budget"
+	case ReasonDiskSpace:
+		return "disk space"
+	case ReasonCompress:
+		return "compress"
+	case ReasonInterrupted:
+		return "interrupted"
+	default:
+		return fmt.Sprintf("RetentionReason(%d)", int(r))
+	}
+}
+
+// RetentionPlanner is implemented by the Writer returned by New, to tell what
+// cleaning up old log files would do.  It is kept out of Writer so that other
+// implementations of Writer don't need it.
+type RetentionPlanner interface {
+	PlanRetention() (RetentionPlan, error)
+}
+
+// RetentionAction is a backup that is compressed or removed, and why.
+type RetentionAction struct {
+	Path   string
+	Reason RetentionReason
+}
+
+// RetentionPlan lists the backups that cleaning up old log files would
+// compress and remove.
+type RetentionPlan struct {
+	Compress []RetentionAction
+	Remove   []RetentionAction
+}
+
+// String lists the plan one backup per line, removals first.
+func (p RetentionPlan) String() string {
+	var b strings.Builder
+	for _, a := range p.Remove {
+		fmt.Fprintf(&b, "remove %s (%s)\n", a.Path, a.Reason)
+	}
+	for _, a := range p.Compress {
+		fmt.Fprintf(&b, "compress %s (%s)\n", a.Path, a.Reason)
+	}
+	return b.String()
+}
+
+// plannedFile is a backup that the mill is going to compress or remove, and
+// why.
+type plannedFile struct {
+	logInfo
+	reason RetentionReason
+}
+
+// newRetentionPlan returns the plan to compress and remove the given backups.
+func newRetentionPlan(compress, remove []plannedFile) RetentionPlan {
+	var p RetentionPlan
+	for _, f := range compress {
+		p.Compress = append(p.Compress, RetentionAction{Path: f.path(), Reason: f.reason})
+	}
+	for _, f := range remove {
+		p.Remove = append(p.Remove, RetentionAction{Path: f.path(), Reason: f.reason})
+	}
+	return p
+}
+
+// PlanRetention returns the backups that cleaning up old log files would
+// compress and remove right now, and why, without touching any of them.
+func (l *loggerOption) PlanRetention() (RetentionPlan, error) {
+	l.millMu.Lock()
+	defer l.millMu.Unlock()
+
+	compress, remove, err := l.planRetention()
+	if err != nil {
+		return RetentionPlan{}, err
+	}
+	return newRetentionPlan(compress, remove), nil
+}
+
+// reportPlan passes a plan made in dry-run mode to the plan handler, or
+// writes it to stderr if there is none.
+func (l *loggerOption) reportPlan(p RetentionPlan) {
+	if l.planHandler != nil {
+		l.planHandler(p)
+		return
+	}
+	io.WriteString(stderr, p.String()) // nolint
+}
+
+// ageCutoff returns the time before which backups are too old to keep at now,
+// or the zero time if they are kept regardless of age.  If several age limits
+// are set, the strictest one wins.
+//
+// MaxDays and MaxAge count back exact durations, while the calendar limits
+// count back whole calendar days or months in the retention location, so that
+// keeping 7 calendar days keeps today and the 6 days before it, however long
+// those days were.
+func (l *loggerOption) ageCutoff(now time.Time) time.Time {
+	var cutoff time.Time
+	later := func(t time.Time) {
+		if t.After(cutoff) {
+			cutoff = t
+		}
+	}
+
+	if l.maxDays > 0 {
+		diff := time.Duration(int64(24*time.Hour) * int64(l.maxDays)) // nolint
+		later(now.Add(-1 * diff))
+	}
+	if l.maxAge > 0 {
+		later(now.Add(-1 * l.maxAge))
+	}
+
+	loc := l.retentionLocation
+	if loc == nil {
+		loc = l.location()
+	}
+	y, m, d := now.In(loc).Date()
+	if l.maxCalendarDays > 0 {
+		later(time.Date(y, m, d-l.maxCalendarDays+1, 0, 0, 0, 0, loc))
+	}
+	if l.maxCalendarMonths > 0 {
+		later(time.Date(y, m-time.Month(l.maxCalendarMonths)+1, 1, 0, 0, 0, 0, loc))
+	}
+	return cutoff
+}
+
+// legacyLogFiles returns the files matching the legacy backup glob, other than
+// the current log file and those among logFiles, aged by the last time they
+// were written.
+func (l *loggerOption) legacyLogFiles(logFiles []logInfo) ([]logInfo, error) {
+	matches, err := filepath.Glob(l.legacyBackups)
+	if err != nil {
+		return nil, fmt.Errorf("can't match legacy backups: %s", err)
+	}
+
+	known := make(map[string]bool)
+	for _, f := range logFiles {
+		known[f.path()] = true
+	}
+	current, _ := l.current.Load().(string)
+	known[current] = true
+
+	legacy := []logInfo{}
+	for _, match := range matches {
+		match = filepath.Clean(match)
+		if known[match] {
+			continue
+		}
+		info, err := os.Lstat(match)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		legacy = append(legacy, logInfo{
+			timestamp: info.ModTime(),
+			dir:       filepath.Dir(match),
+			legacy:    true,
+			FileInfo:  info,
+		})
+	}
+	return legacy, nil
+}
@@ -0,0 +1,362 @@
+package lumberjack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgeCutoff(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+
+	// two days after the clocks went forward.
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, ny)
+
+	tests := []struct {
+		name string
+		l    *loggerOption
+		want time.Time
+	}{
+		{"none", &loggerOption{}, time.Time{}},
+		{"days", &loggerOption{maxDays: 7}, now.Add(-7 * 24 * time.Hour)},
+		{"age", &loggerOption{maxAge: 6 * time.Hour}, now.Add(-6 * time.Hour)},
+		{"strictest", &loggerOption{maxDays: 1, maxAge: 6 * time.Hour}, now.Add(-6 * time.Hour)},
+		{
+			"calendar day",
+			&loggerOption{maxCalendarDays: 1, retentionLocation: ny},
+			time.Date(2026, 3, 10, 0, 0, 0, 0, ny),
+		},
+		{
+			"calendar week",
+			&loggerOption{maxCalendarDays: 7, retentionLocation: ny},
+			time.Date(2026, 3, 4, 0, 0, 0, 0, ny),
+		},
+		{
+			"calendar month",
+			&loggerOption{maxCalendarMonths: 1, retentionLocation: ny},
+			time.Date(2026, 3, 1, 0, 0, 0, 0, ny),
+		},
+		{
+			"calendar quarter",
+			&loggerOption{maxCalendarMonths: 3, retentionLocation: ny},
+			time.Date(2026, 1, 1, 0, 0, 0, 0, ny),
+		},
+		{
+			"calendar days in UTC",
+			&loggerOption{maxCalendarDays: 3},
+			time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		got := test.l.ageCutoff(now)
+		require.True(t, test.want.Equal(got), "%s: want %v, got %v", test.name, test.want, got)
+	}
+}
+
+func TestMaxAgeDuration(t *testing.T) {
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestMaxAgeDuration", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBytes(10),
+		WithMaxAge(6*time.Hour),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+
+	newFakeTime()
+	b2 := []byte("foooooo!")
+	_, err = l.Write(b2)
+	require.NoError(t, err)
+	first := backupFile(dir)
+
+	newFakeTime()
+	b3 := []byte("baaaaar!")
+	_, err = l.Write(b3)
+	require.NoError(t, err)
+	second := backupFile(dir)
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+
+	// the first backup is two days old, well past the cutoff.
+	notExist(first, t)
+	existsWithContent(second, b2, t)
+	existsWithContent(filename, b3, t)
+}
+
+func TestMaxAgeLocalTime(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	local := time.Local
+	time.Local = ny
+	defer func() { time.Local = local }()
+
+	currentTime = fakeTime
+	defer func(now time.Time) { fakeCurrentTime = now }(fakeCurrentTime)
+	fakeCurrentTime = time.Date(2026, 3, 10, 9, 0, 0, 0, ny)
+
+	dir := makeTempDir("TestMaxAgeLocalTime", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBytes(10),
+		WithMaxAge(3*time.Hour),
+		WithLocalTime(),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+
+	b2 := []byte("foooooo!")
+	_, err = l.Write(b2)
+	require.NoError(t, err)
+	first := backupFileLocal(dir)
+
+	fakeCurrentTime = fakeCurrentTime.Add(time.Hour)
+	b3 := []byte("baaaaar!")
+	_, err = l.Write(b3)
+	require.NoError(t, err)
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+
+	// the first backup was rotated an hour ago in local time, well within
+	// the limit.
+	existsWithContent(first, b, t)
+	existsWithContent(backupFileLocal(dir), b2, t)
+	existsWithContent(filename, b3, t)
+}
+
+func TestMaxCalendarDaysLocalTime(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	local := time.Local
+	time.Local = tokyo
+	defer func() { time.Local = local }()
+
+	currentTime = fakeTime
+	defer func(now time.Time) { fakeCurrentTime = now }(fakeCurrentTime)
+	fakeCurrentTime = time.Date(2026, 3, 9, 20, 0, 0, 0, tokyo)
+
+	dir := makeTempDir("TestMaxCalendarDaysLocalTime", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBytes(10),
+		WithMaxCalendarDays(1),
+		WithLocalTime(),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+
+	b2 := []byte("foooooo!")
+	_, err = l.Write(b2)
+	require.NoError(t, err)
+	first := backupFileLocal(dir)
+
+	// the next morning.
+	fakeCurrentTime = time.Date(2026, 3, 10, 9, 0, 0, 0, tokyo)
+	b3 := []byte("baaaaar!")
+	_, err = l.Write(b3)
+	require.NoError(t, err)
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+
+	// the first backup was rotated on the previous local day.
+	notExist(first, t)
+	existsWithContent(backupFileLocal(dir), b2, t)
+	existsWithContent(filename, b3, t)
+}
+
+func TestAgeByModTime(t *testing.T) {
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestAgeByModTime", t)
+	defer os.RemoveAll(dir) // nolint
+
+	// a backup copied in by another tool, named recently but written long ago.
+	copied := backupFile(dir)
+	require.NoError(t, ioutil.WriteFile(copied, []byte("copied"), 0600))
+	old := fakeTime().Add(-72 * time.Hour)
+	require.NoError(t, os.Chtimes(copied, old, old))
+
+	// a backup renamed with an old name, but written recently.
+	renamed := filepath.Join(dir, "foobar-2001-01-01T00-00-00.000.log")
+	require.NoError(t, ioutil.WriteFile(renamed, []byte("renamed"), 0600))
+	recent := fakeTime().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(renamed, recent, recent))
+
+	l, err := New(
+		WithFileName(logFile(dir)),
+		WithMaxDays(1),
+		WithAgeByModTime(),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+
+	notExist(copied, t)
+	existsWithContent(renamed, []byte("renamed"), t)
+}
+
+func TestLegacyBackups(t *testing.T) {
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestLegacyBackups", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	stale := filename + ".old"
+	require.NoError(t, ioutil.WriteFile(stale, []byte("stale"), 0600))
+	old := fakeTime().Add(-72 * time.Hour)
+	require.NoError(t, os.Chtimes(stale, old, old))
+
+	fresh := filename + ".new"
+	require.NoError(t, ioutil.WriteFile(fresh, []byte("fresh"), 0600))
+	recent := fakeTime().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(fresh, recent, recent))
+
+	l, err := New(
+		WithFileName(filename),
+		WithMaxDays(1),
+		WithCompress(),
+		WithLegacyBackups(filename+"*"),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+
+	// the stale legacy backup is removed, and the fresh one is left alone
+	// rather than compressed.
+	notExist(stale, t)
+	existsWithContent(fresh, []byte("fresh"), t)
+	notExist(fresh+compressSuffix, t)
+	existsWithContent(filename, []byte{}, t)
+}
+
+func TestPlanRetention(t *testing.T) {
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestPlanRetention", t)
+	defer os.RemoveAll(dir) // nolint
+
+	backup := func(age time.Duration, suffix string) string {
+		name := filepath.Join(dir, "foobar-"+fakeTime().Add(-age).UTC().Format(backupTimeFormat)+".log"+suffix)
+		require.NoError(t, ioutil.WriteFile(name, []byte("backup"), 0600))
+		return name
+	}
+	newest := backup(time.Hour, "")
+	compressed := backup(2*time.Hour, compressSuffix)
+	old := backup(48*time.Hour, "")
+	oldest := backup(96*time.Hour, "")
+
+	plans := make(chan RetentionPlan, 1)
+	l, err := New(
+		WithFileName(logFile(dir)),
+		WithMaxBackups(3),
+		WithMaxDays(1),
+		WithCompress(),
+		WithDryRun(func(p RetentionPlan) { plans <- p }),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	want := RetentionPlan{
+		Compress: []RetentionAction{{Path: newest, Reason: ReasonCompress}},
+		Remove: []RetentionAction{
+			{Path: oldest, Reason: ReasonCount},
+			{Path: old, Reason: ReasonAge},
+		},
+	}
+
+	select {
+	case p := <-plans:
+		require.Equal(t, want, p)
+	case <-time.After(time.Second):
+		t.Fatal("dry run didn't report a plan")
+	}
+
+	p, err := l.(RetentionPlanner).PlanRetention()
+	require.NoError(t, err)
+	require.Equal(t, want, p)
+	require.Equal(t, "remove "+oldest+" (count)\nremove "+old+" (age)\ncompress "+newest+" (compress)\n", p.String())
+
+	// nothing was touched.
+	for _, name := range []string{newest, compressed, old, oldest} {
+		exists(name, t)
+	}
+	notExist(newest+compressSuffix, t)
+}
+
+func TestPlanRetentionWhileCompressing(t *testing.T) {
+	currentTime = fakeTime
+
+	dir := makeTempDir("TestPlanRetentionWhileCompressing", t)
+	defer os.RemoveAll(dir) // nolint
+
+	backup := backupFile(dir)
+	require.NoError(t, ioutil.WriteFile(backup, []byte("backup"), 0600))
+
+	var count int32
+	c := gateCompressor{gate: make(chan struct{}), count: &count}
+	l, err := New(
+		WithFileName(logFile(dir)),
+		WithCompressor(c),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	// the compressed file being written isn't planned for removal.
+	<-time.After(10 * time.Millisecond)
+	exists(backup+".nop"+compressTmpSuffix, t)
+	p, err := l.(RetentionPlanner).PlanRetention()
+	require.NoError(t, err)
+	require.Empty(t, p.Remove)
+
+	close(c.gate)
+	<-time.After(100 * time.Millisecond)
+	notExist(backup, t)
+	existsWithContent(backup+".nop", []byte("backup"), t)
+}
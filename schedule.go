@@ -0,0 +1,146 @@
+package lumberjack
+
+import (
+	"context"
+	"time"
+)
+
+// Scheduler is implemented by the Writer returned by New, to tell when the log
+// file will next be rotated on schedule.  It is kept out of Writer so that
+// other implementations of Writer don't need it:
+//
+//	if s, ok := w.(Scheduler); ok {
+//		next := s.NextRotation()
+//	}
+type Scheduler interface {
+	NextRotation() time.Time
+}
+
+// Schedule determines the wall-clock times at which the log file is rotated.
+type Schedule interface {
+	// Next returns the first rotation time strictly after t, in t's location,
+	// or the zero time if there is none.
+	Next(t time.Time) time.Time
+}
+
+// Interval is a Schedule that rotates on the boundaries of a fixed wall-clock
+// period.
+type Interval int
+
+const (
+	// Hourly rotates at the top of every hour.
+	Hourly Interval = iota + 1
+	// Daily rotates at midnight.
+	Daily
+	// Weekly rotates at midnight between Sunday and Monday.
+	Weekly
+)
+
+// Next returns the first boundary of the interval strictly after t, in t's
+// location.
+func (i Interval) Next(t time.Time) time.Time {
+	y, m, d := t.Date()
+	loc := t.Location()
+
+	var next time.Time
+	switch i {
+	case Hourly:
+		next = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, loc)
+		// An ambiguous hour at the end of daylight saving time may normalize
+		// to a time that has already passed.
+		if !next.After(t) {
+			next = next.Add(time.Hour)
+		}
+	case Daily:
+		next = time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+	case Weekly:
+		days := (8 - int(t.Weekday())) % 7 // nolint
+		if days == 0 {
+			days = 7
+		}
+		next = time.Date(y, m, d+days, 0, 0, 0, 0, loc)
+	}
+	return next
+}
+
+// location returns the location used for timestamps, which is the local time
+// if requested (otherwise UTC).
+func (l *loggerOption) location() *time.Location {
+	if l.localTime {
+		return time.Local
+	}
+	return time.UTC
+}
+
+// timeIn returns t in the location used for timestamps.
+func (l *loggerOption) timeIn(t time.Time) time.Time {
+	return t.In(l.location())
+}
+
+// rotationDue reports whether the schedule's next rotation time has passed at
+// now.
+func (l *loggerOption) rotationDue(now time.Time) bool {
+	return l.schedule != nil && !l.nextRotation.IsZero() && !now.Before(l.nextRotation)
+}
+
+// NextRotation returns the next time at which the schedule will rotate the log
+// file, or the zero time if no schedule is configured.
+func (l *loggerOption) NextRotation() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.nextRotation
+}
+
+// rotateDue rotates the file because the rotation time due has been reached,
+// and schedules the next rotation.  The next rotation is scheduled even if
+// rotating fails, so a broken file system doesn't make the schedule spin.
+func (l *loggerOption) rotateDue(due time.Time) error {
+	l.scheduleAfter(due)
+	return l.rotate()
+}
+
+// scheduleAfter sets the next rotation to the first one after the rotation
+// time due and the current time.
+func (l *loggerOption) scheduleAfter(due time.Time) {
+	now := currentTime()
+	if now.Before(due) {
+		now = due
+	}
+	l.nextRotation = l.schedule.Next(l.timeIn(now))
+}
+
+// rotateRun runs in a goroutine to rotate the log file at the scheduled times
+// even when nothing is being written.
+func (l *loggerOption) rotateRun(ctx context.Context) {
+	for {
+		l.mu.Lock()
+		due := l.nextRotation
+		l.mu.Unlock()
+
+		if due.IsZero() {
+			<-ctx.Done()
+			return
+		}
+
+		timer := time.NewTimer(due.Sub(currentTime()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		l.mu.Lock()
+		// A write may already have rotated the file for this time.  If a
+		// failed rotation left no file to rotate, this time is skipped
+		// rather than retried at once, over and over.
+		if l.nextRotation.Equal(due) {
+			if l.isClose() {
+				l.scheduleAfter(due)
+			} else {
+				l.rotateDue(due) // nolint
+			}
+		}
+		l.mu.Unlock()
+	}
+}
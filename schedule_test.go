@@ -0,0 +1,157 @@
+package lumberjack
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntervalNext(t *testing.T) {
+	// 2020-10-07 was a Wednesday.
+	now := time.Date(2020, 10, 7, 14, 44, 33, 0, time.UTC)
+
+	tests := []struct {
+		every Interval
+		want  time.Time
+	}{
+		{Hourly, time.Date(2020, 10, 7, 15, 0, 0, 0, time.UTC)},
+		{Daily, time.Date(2020, 10, 8, 0, 0, 0, 0, time.UTC)},
+		{Weekly, time.Date(2020, 10, 12, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.want, test.every.Next(now))
+	}
+
+	// a boundary is never the next boundary after itself.
+	monday := time.Date(2020, 10, 12, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, time.Date(2020, 10, 19, 0, 0, 0, 0, time.UTC), Weekly.Next(monday))
+}
+
+func TestRotateEveryOnWrite(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestRotateEveryOnWrite", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBytes(100),
+		WithRotateEvery(Daily),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+	fileCount(dir, 1, t)
+
+	// two days later, well past midnight.
+	newFakeTime()
+
+	b2 := []byte("foooooo!")
+	n, err = l.Write(b2)
+	require.NoError(t, err)
+	require.Equal(t, len(b2), n)
+	existsWithContent(filename, b2, t)
+	existsWithContent(backupFile(dir), b, t)
+	fileCount(dir, 2, t)
+}
+
+func TestRotateEveryOnTimer(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestRotateEveryOnTimer", t)
+	defer os.RemoveAll(dir) // nolint
+
+	// just before the top of the hour.
+	fakeCurrentTime = Hourly.Next(fakeCurrentTime.UTC()).Add(-50 * time.Millisecond)
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithRotateEvery(Hourly),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+
+	// the boundary passes without any further writes.
+	<-time.After(200 * time.Millisecond)
+
+	existsWithContent(filename, []byte{}, t)
+	existsWithContent(backupFile(dir), b, t)
+	fileCount(dir, 2, t)
+}
+
+func TestRotateEveryAfterFailure(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestRotateEveryAfterFailure", t)
+	defer os.RemoveAll(dir) // nolint
+
+	rename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrPermission}
+	}
+	defer func() { rename = os.Rename }()
+
+	// just before the top of the hour.
+	due := Hourly.Next(fakeCurrentTime.UTC())
+	fakeCurrentTime = due.Add(-50 * time.Millisecond)
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithRotateEvery(Hourly),
+		WithMaxBytes(10),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	_, err = l.Write([]byte("boo!"))
+	require.NoError(t, err)
+
+	// rotating for size fails and leaves the file closed.
+	_, err = l.Write([]byte("foooooo!"))
+	require.Error(t, err)
+	require.Equal(t, due, l.(Scheduler).NextRotation())
+
+	// with no file to rotate at the top of the hour, the schedule moves on to
+	// the next hour instead of spinning.
+	<-time.After(200 * time.Millisecond)
+	require.Equal(t, Hourly.Next(due), l.(Scheduler).NextRotation())
+}
+
+func TestRotateEveryOnResume(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestRotateEveryOnResume", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	data := []byte("foo!")
+	err := ioutil.WriteFile(filename, data, 0600)
+	require.NoError(t, err)
+
+	// the file was last written before yesterday's midnight.
+	old := fakeTime().Add(-48 * time.Hour)
+	err = os.Chtimes(filename, old, old)
+	require.NoError(t, err)
+
+	l, err := New(
+		WithFileName(filename),
+		WithRotateEvery(Daily),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	existsWithContent(filename, []byte{}, t)
+	existsWithContent(backupFile(dir), data, t)
+	fileCount(dir, 2, t)
+}
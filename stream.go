@@ -0,0 +1,95 @@
+package lumberjack
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// streamWriter compresses what is written to the active file, one compressed
+// member per flush, so that the file can be read whole whenever it has been
+// flushed.  Members are only started on a write, so flushing without writing
+// adds nothing to the file.
+type streamWriter struct {
+	file io.Writer
+	c    Compressor
+	w    io.WriteCloser
+}
+
+// Write implements io.Writer.
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.w == nil {
+		w, err := s.c.NewWriter(s.file)
+		if err != nil {
+			return 0, err
+		}
+		s.w = w
+	}
+	return s.w.Write(p)
+}
+
+// endMember finishes the current member, if there is one.
+func (s *streamWriter) endMember() error {
+	if s.w == nil {
+		return nil
+	}
+	err := s.w.Close()
+	s.w = nil
+	return err
+}
+
+// streamSuffix returns the suffix of the active file and its backups, which is
+// the compressor's when the active file is compressed as it is written.
+func (l *loggerOption) streamSuffix() string {
+	if l.stream {
+		return l.compressor.Suffix()
+	}
+	return ""
+}
+
+// activePath returns the path of the active file for the named log file.
+func (l *loggerOption) activePath(name string) string {
+	return name + l.streamSuffix()
+}
+
+// setBuffer buffers writes to file, compressing them first if the active file
+// is compressed as it is written.
+func (l *loggerOption) setBuffer(file *os.File) {
+	if !l.stream {
+		l.buf = bufio.NewWriterSize(file, l.bufSize)
+		return
+	}
+	l.streamer = &streamWriter{file: file, c: l.compressor}
+	l.buf = bufio.NewWriterSize(l.streamer, l.bufSize)
+}
+
+// flush writes out the buffer and, if the active file is compressed as it is
+// written, finishes the current member.
+func (l *loggerOption) flush() error {
+	if err := l.buf.Flush(); err != nil {
+		return err
+	}
+	if l.streamer != nil {
+		return l.streamer.endMember()
+	}
+	return nil
+}
+
+// countStream returns the number of bytes and newlines that were written to the
+// named compressed file.  It fails if the file isn't a whole compressed
+// stream, such as when the last member was cut short by a crash.
+func (l *loggerOption) countStream(name string) (size, lines int64, err error) {
+	f, err := os.Open(name) // nolint
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close() // nolint
+
+	r, err := l.compressor.NewReader(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer r.Close() // nolint
+
+	return countReader(r)
+}
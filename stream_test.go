@@ -0,0 +1,153 @@
+package lumberjack
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamCompression(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestStreamCompression", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	opts := []LoggerOption{
+		WithFileName(filename),
+		WithStreamCompression(),
+	}
+	l, err := New(opts...)
+	require.NoError(t, err)
+
+	_, err = l.Write([]byte("boo!\n"))
+	require.NoError(t, err)
+	require.NoError(t, l.Flush())
+	gzipWithContent(filename+compressSuffix, []byte("boo!\n"), t)
+	notExist(filename, t)
+
+	// every flush ends a member, so the file stays readable.
+	_, err = l.Write([]byte("foo\n"))
+	require.NoError(t, err)
+	require.NoError(t, l.Flush())
+	require.NoError(t, l.Flush())
+	gzipWithContent(filename+compressSuffix, []byte("boo!\nfoo\n"), t)
+	require.NoError(t, l.Close())
+
+	// on resume, new members are appended.
+	l, err = New(opts...)
+	require.NoError(t, err)
+	_, err = l.Write([]byte("bar\n"))
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+	gzipWithContent(filename+compressSuffix, []byte("boo!\nfoo\nbar\n"), t)
+	fileCount(dir, 1, t)
+}
+
+func TestStreamCompressionNotConcatenable(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestStreamCompressionNotConcatenable", t)
+	defer os.RemoveAll(dir) // nolint
+
+	// a zlib or deflate file is unreadable past its first member.
+	for _, c := range []Compressor{Zlib(zlib.DefaultCompression), Flate(flate.DefaultCompression)} {
+		_, err := New(
+			WithFileName(logFile(dir)),
+			WithCompressor(c),
+			WithStreamCompression(),
+		)
+		require.Error(t, err, c.Suffix())
+	}
+	fileCount(dir, 0, t)
+}
+
+func TestStreamCompressionRotate(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestStreamCompressionRotate", t)
+	defer os.RemoveAll(dir) // nolint
+
+	filename := logFile(dir)
+	opts := []LoggerOption{
+		WithFileName(filename),
+		WithStreamCompression(),
+		WithMaxBytes(10),
+	}
+	l, err := New(opts...)
+	require.NoError(t, err)
+
+	b := []byte("boo!\n")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	// the size of what was written is counted on resume, not the compressed
+	// size, which is larger for so little.
+	l, err = New(opts...)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	_, err = l.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, l.Flush())
+	gzipWithContent(filename+compressSuffix, []byte("boo!\nboo!\n"), t)
+
+	newFakeTime()
+	b2 := []byte("foo!\n")
+	_, err = l.Write(b2)
+	require.NoError(t, err)
+	require.NoError(t, l.Flush())
+
+	gzipWithContent(backupFile(dir)+compressSuffix, []byte("boo!\nboo!\n"), t)
+	gzipWithContent(filename+compressSuffix, b2, t)
+	fileCount(dir, 2, t)
+}
+
+func TestStreamCompressionCorrupt(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestStreamCompressionCorrupt", t)
+	defer os.RemoveAll(dir) // nolint
+
+	// a crash cut the last member short.
+	filename := logFile(dir)
+	f, err := os.Create(filename + compressSuffix)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	_, err = gz.Write([]byte("lost\n"))
+	require.NoError(t, err)
+	require.NoError(t, gz.Flush())
+	require.NoError(t, f.Close())
+
+	newFakeTime()
+	l, err := New(
+		WithFileName(filename),
+		WithStreamCompression(),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	// rather than appending to it, it is moved aside.
+	b := []byte("boo!\n")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, l.Flush())
+	exists(backupFile(dir)+compressSuffix, t)
+	gzipWithContent(filename+compressSuffix, b, t)
+}
+
+// gzipWithContent checks that the given file is a whole gzip stream of the
+// given content.
+func gzipWithContent(path string, content []byte, t testing.TB) {
+	f, err := os.Open(path) // nolint
+	require.NoError(t, err)
+	defer f.Close() // nolint
+
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(gz)
+	require.NoError(t, err)
+	require.Equal(t, content, b)
+}
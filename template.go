@@ -0,0 +1,233 @@
+package lumberjack
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templateToken is the kind of a piece of a backup template.
+type templateToken int
+
+const (
+	tokenLiteral templateToken = iota
+	tokenPrefix
+	tokenExt
+	tokenName
+	tokenTime
+	tokenSeq
+)
+
+// templatePart is a piece of a backup template: literal text or a token.
+type templatePart struct {
+	token templateToken
+	text  string
+}
+
+// backupTemplate names backups from a template such as
+// `{dir}/{prefix}.{time:20060102-150405}.{seq}{ext}`, and recognizes the names
+// it generates.  The tokens are:
+//
+//	{dir}          the directory of the log file, only as a leading `{dir}/`
+//	{prefix}       the log file name without its extension
+//	{ext}          the extension of the log file name, including the dot
+//	{name}         the log file name
+//	{time:LAYOUT}  the rotation time, formatted with the time.Time layout
+//	{seq}          a sequence number that keeps backups from colliding
+//
+// A template needs exactly one {time:LAYOUT} token, exactly one {seq} token so
+// that backups rotated within the same time never overwrite each other, and
+// {prefix} or {name} so that backups of different log files in the same
+// directory are told apart.  {time:LAYOUT} and {seq} need literal text between
+// them so they can be told apart.
+type backupTemplate struct {
+	parts  []templatePart
+	layout string
+	seq    bool
+
+	// timeGroup and seqGroup are the indexes of the time and the sequence
+	// number among the submatches of the template's expression.
+	timeGroup, seqGroup int
+}
+
+// parseTemplate parses a backup template.
+func parseTemplate(tmpl string) (*backupTemplate, error) {
+	rest := strings.TrimPrefix(tmpl, "{dir}/")
+	if strings.ContainsAny(rest, `/\`) {
+		return nil, fmt.Errorf("backup template %q may only have a leading {dir}/ directory", tmpl)
+	}
+
+	t := &backupTemplate{}
+	times, groups, names := 0, 0, 0
+	for rest != "" {
+		open := strings.Index(rest, "{")
+		if open != 0 {
+			if open < 0 {
+				open = len(rest)
+			}
+			t.parts = append(t.parts, templatePart{token: tokenLiteral, text: rest[:open]})
+			rest = rest[open:]
+			continue
+		}
+
+		end := strings.Index(rest, "}")
+		if end < 0 {
+			return nil, fmt.Errorf("backup template %q has an unclosed token", tmpl)
+		}
+		name := rest[1:end]
+		rest = rest[end+1:]
+
+		var part templatePart
+		switch {
+		case name == "prefix":
+			part.token = tokenPrefix
+			names++
+		case name == "ext":
+			part.token = tokenExt
+		case name == "name":
+			part.token = tokenName
+			names++
+		case name == "seq":
+			if t.seq {
+				return nil, fmt.Errorf("backup template %q has more than one {seq}", tmpl)
+			}
+			part.token = tokenSeq
+			t.seq = true
+		case strings.HasPrefix(name, "time:") && len(name) > len("time:"):
+			part.token = tokenTime
+			t.layout = name[len("time:"):]
+			times++
+		default:
+			return nil, fmt.Errorf("backup template %q has unknown token {%s}", tmpl, name)
+		}
+
+		if isCaptured(part.token) {
+			n := len(t.parts)
+			if n > 0 && isCaptured(t.parts[n-1].token) {
+				return nil, fmt.Errorf("backup template %q needs text between {time} and {seq}", tmpl)
+			}
+			groups++
+			if part.token == tokenTime {
+				t.timeGroup = groups
+			} else {
+				t.seqGroup = groups
+			}
+		}
+		t.parts = append(t.parts, part)
+	}
+
+	if times != 1 {
+		return nil, fmt.Errorf("backup template %q needs exactly one {time:LAYOUT}", tmpl)
+	}
+	if !t.seq {
+		return nil, fmt.Errorf("backup template %q needs a {seq}", tmpl)
+	}
+	if names == 0 {
+		return nil, fmt.Errorf("backup template %q needs a {prefix} or {name}", tmpl)
+	}
+	return t, nil
+}
+
+// isCaptured reports whether the token's text varies between backups.
+func isCaptured(token templateToken) bool {
+	return token == tokenTime || token == tokenSeq
+}
+
+// render returns the backup filename for the log file with the given base name.
+func (t *backupTemplate) render(base string, ts time.Time, seq int) string {
+	ext := filepath.Ext(base)
+	prefix := base[:len(base)-len(ext)]
+
+	var b strings.Builder
+	for _, part := range t.parts {
+		switch part.token {
+		case tokenLiteral:
+			b.WriteString(part.text)
+		case tokenPrefix:
+			b.WriteString(prefix)
+		case tokenExt:
+			b.WriteString(ext)
+		case tokenName:
+			b.WriteString(base)
+		case tokenTime:
+			b.WriteString(ts.Format(t.layout))
+		case tokenSeq:
+			b.WriteString(strconv.Itoa(seq))
+		}
+	}
+	return b.String()
+}
+
+// backupName returns the name to move the named log file to at the rotation
+// time ts, with the lowest sequence number that doesn't collide with a backup
+// for which taken reports true.
+func (t *backupTemplate) backupName(name string, ts time.Time, taken func(string) bool) string {
+	dir, base := filepath.Split(name)
+	seq := 1
+	for {
+		candidate := filepath.Join(dir, t.render(base, ts, seq))
+		if !taken(candidate) {
+			return candidate
+		}
+		seq++
+	}
+}
+
+// regexp returns an expression matching the backup filenames of the log file
+// with the given base name, capturing the time and then the sequence number.
+func (t *backupTemplate) regexp(base string) *regexp.Regexp {
+	ext := filepath.Ext(base)
+	prefix := base[:len(base)-len(ext)]
+
+	var b strings.Builder
+	b.WriteString("^")
+	for _, part := range t.parts {
+		switch part.token {
+		case tokenLiteral:
+			b.WriteString(regexp.QuoteMeta(part.text))
+		case tokenPrefix:
+			b.WriteString(regexp.QuoteMeta(prefix))
+		case tokenExt:
+			b.WriteString(regexp.QuoteMeta(ext))
+		case tokenName:
+			b.WriteString(regexp.QuoteMeta(base))
+		case tokenTime:
+			b.WriteString("(.+?)")
+		case tokenSeq:
+			b.WriteString(`(\d+)`)
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// parse extracts the rotation time and sequence number from a backup filename
+// matched by re, parsing the time in loc.
+func (t *backupTemplate) parse(re *regexp.Regexp, filename string, loc *time.Location) (time.Time, int, error) {
+	m := re.FindStringSubmatch(filename)
+	if m == nil {
+		return time.Time{}, 0, errors.New("mismatched template")
+	}
+
+	ts, err := time.ParseInLocation(t.layout, m[t.timeGroup], loc)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	seq, err := strconv.Atoi(m[t.seqGroup])
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return ts, seq, nil
+}
+
+// fileExists reports whether something exists at the given name.
+func fileExists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
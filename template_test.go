@@ -0,0 +1,154 @@
+package lumberjack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		tmpl    string
+		wantErr bool
+	}{
+		{"{dir}/{prefix}.{time:20060102-150405}.{seq}{ext}", false},
+		{"{name}-{time:2006-01-02}.{seq}", false},
+		{"{name}-{time:2006-01-02}", true},
+		{"backup.{time:20060102}.{seq}.log", true},
+		{"{prefix}{ext}", true},
+		{"{prefix}.{time:20060102}{seq}{ext}", true},
+		{"{prefix}.{time:20060102}.{time:150405}{ext}", true},
+		{"{prefix}.{time:20060102}.{seq}.{seq}{ext}", true},
+		{"{dir}/old/{prefix}.{time:20060102}{ext}", true},
+		{"{prefix}.{time:20060102}.{host}{ext}", true},
+		{"{prefix}.{time:20060102", true},
+	}
+
+	for _, test := range tests {
+		_, err := parseTemplate(test.tmpl)
+		require.Equal(t, test.wantErr, err != nil, test.tmpl)
+	}
+}
+
+func TestTemplateRoundTrip(t *testing.T) {
+	tmpl, err := parseTemplate("{dir}/{prefix}.{time:20060102-150405}.{seq}{ext}")
+	require.NoError(t, err)
+
+	ts := time.Date(2020, 10, 9, 14, 44, 33, 0, time.UTC)
+	name := tmpl.render("foo.log", ts, 3)
+	require.Equal(t, "foo.20201009-144433.3.log", name)
+
+	re := tmpl.regexp("foo.log")
+	got, seq, err := tmpl.parse(re, name, time.UTC)
+	require.NoError(t, err)
+	require.Equal(t, ts, got)
+	require.Equal(t, 3, seq)
+
+	for _, other := range []string{"foo.log", "foo.20201009-144433.log", "bar.20201009-144433.3.log", "foo.2020.3.log"} {
+		_, _, err := tmpl.parse(re, other, time.UTC)
+		require.Error(t, err, other)
+	}
+}
+
+func TestBackupFormat(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestBackupFormat", t)
+	defer os.RemoveAll(dir) // nolint
+
+	format := "{prefix}.{time:20060102-150405}.{seq}{ext}"
+	backup := func(seq int) string {
+		name := "foobar." + fakeTime().UTC().Format("20060102-150405") + "." + strconv.Itoa(seq) + ".log"
+		return filepath.Join(dir, name)
+	}
+
+	// a backup from a previous day that is past MaxBackups.
+	data := []byte("data")
+	old := backup(1)
+	err := ioutil.WriteFile(old, data, 0600)
+	require.NoError(t, err)
+
+	newFakeTime()
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithMaxBytes(10),
+		WithMaxBackups(2),
+		WithBackupFormat(format),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	n, err := l.Write(b)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+
+	// two rotations at the same time get different sequence numbers.
+	err = l.Rotate()
+	require.NoError(t, err)
+
+	b2 := []byte("foo!")
+	n, err = l.Write(b2)
+	require.NoError(t, err)
+	require.Equal(t, len(b2), n)
+
+	err = l.Rotate()
+	require.NoError(t, err)
+
+	// we need to wait a little bit since the files get deleted on a different
+	// goroutine.
+	<-time.After(10 * time.Millisecond)
+
+	existsWithContent(backup(1), b, t)
+	existsWithContent(backup(2), b2, t)
+	notExist(old, t)
+	fileCount(dir, 3, t)
+
+	_, err = New(
+		WithFileName(filename),
+		WithBackupFormat("{prefix}{ext}"),
+	)
+	require.Error(t, err)
+}
+
+func TestBackupFormatCompressedCollision(t *testing.T) {
+	currentTime = fakeTime
+	dir := makeTempDir("TestBackupFormatCompressedCollision", t)
+	defer os.RemoveAll(dir) // nolint
+
+	format := "{prefix}.{time:20060102-150405}.{seq}{ext}"
+	backup := func(seq int) string {
+		name := "foobar." + fakeTime().UTC().Format("20060102-150405") + "." + strconv.Itoa(seq) + ".log"
+		return filepath.Join(dir, name)
+	}
+
+	// a backup from the same second that has already been compressed.
+	data := []byte("data")
+	err := ioutil.WriteFile(backup(1)+compressSuffix, data, 0600)
+	require.NoError(t, err)
+
+	filename := logFile(dir)
+	l, err := New(
+		WithFileName(filename),
+		WithBackupFormat(format),
+	)
+	require.NoError(t, err)
+	defer l.Close() // nolint
+
+	b := []byte("boo!")
+	_, err = l.Write(b)
+	require.NoError(t, err)
+
+	err = l.Rotate()
+	require.NoError(t, err)
+
+	existsWithContent(backup(1)+compressSuffix, data, t)
+	existsWithContent(backup(2), b, t)
+	notExist(backup(1), t)
+}